@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+
+	"github.com/golang/glog"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/external-sfs/pkg/driver"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+)
+
+var (
+	endpoint     = flag.String("endpoint", "unix:///csi/csi.sock", "CSI endpoint")
+	drivername   = flag.String("drivername", driver.DriverName, "Name of the driver")
+	nodeid       = flag.String("nodeid", "", "The ID of the node which the driver is running on")
+	cloudconfig  = flag.String("cloudconfig", "", "Absolute path to the cloud config. The controller service is disabled if it is not set")
+	sharetimeout = flag.Int("sharetimeout", 600, "Share operation timeout. Unit: second")
+	vpcid        = flag.String("vpcid", "", "The ID of VPC which the cluster is belong to")
+	clusterid    = flag.String("clusterid", "", "The ID of the cluster written into the metadata of the shares")
+	zone         = flag.String("zone", "", "The availability zone of the node. It is discovered from the instance metadata if not set")
+
+	sharepollinterval    = flag.Duration("sharepollinterval", sfs.DefaultBackoff.Duration, "Initial interval of polling share status")
+	sharepollfactor      = flag.Float64("sharepollfactor", sfs.DefaultBackoff.Factor, "Factor multiplying the interval of polling share status after each poll")
+	sharepollmaxinterval = flag.Duration("sharepollmaxinterval", sfs.DefaultBackoff.Cap, "Maximum interval of polling share status")
+)
+
+func main() {
+	flag.Parse()
+	flag.Set("logtostderr", "true")
+
+	if *nodeid == "" {
+		glog.Fatal("The node id must be provided")
+	}
+
+	var cc *config.CloudCredentials
+	if *cloudconfig != "" {
+		c, err := config.LoadConfig(*cloudconfig)
+		if err != nil {
+			glog.Fatalf("Failed to load cloud config: %v", err)
+		}
+		cc = &c
+	}
+
+	nodeZone := *zone
+	if nodeZone == "" && cc == nil {
+		z, err := sfs.DiscoverLocalZone()
+		if err != nil {
+			glog.Warningf("Failed to discover the zone of the node: %v", err)
+		}
+		nodeZone = z
+	}
+
+	d := driver.NewDriver(*drivername, *nodeid, *endpoint, cc, *sharetimeout, *vpcid,
+		driver.ShareBackoff(sfs.Backoff{
+			Duration: *sharepollinterval,
+			Factor:   *sharepollfactor,
+			Cap:      *sharepollmaxinterval,
+		}),
+		driver.ClusterID(*clusterid),
+		driver.Zone(nodeZone),
+	)
+	d.Run()
+}
@@ -19,6 +19,7 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	"github.com/golang/glog"
 
@@ -27,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/huaweicloud/external-sfs/pkg/config"
@@ -39,7 +41,31 @@ var (
 	kubeconfig   = flag.String("kubeconfig", "", "Absolute path to the kubeconfig file. Either this or master needs to be set if the provisioner is being run out of cluster.")
 	cloudconfig  = flag.String("cloudconfig", "/etc/origin/cloudprovider/openstack.conf", "Absolute path to the cloud config")
 	sharetimeout = flag.Int("sharetimeout", 600, "Share operation timeout. Unit: second")
-	vpcid        = flag.String("vpcid", "", "The ID of VPC which the cluster is belong to")
+	vpcid        = flag.String("vpcid", "", "The ID of VPC which the cluster is belong to. The VPCs of the nodes are discovered if not set")
+
+	cloudconfigsecret = flag.String("cloudconfigsecret", "", "Namespace/name of the secret holding the cloud config in key "+config.CloudConfigSecretKey+". Overrides cloudconfig if set")
+	cloudconfigresync = flag.Duration("cloudconfigresync", time.Minute, "Interval of checking the cloud config file for changes, 0 disables the reload")
+
+	keepfailedshares = flag.Bool("keepfailedshares", false, "Keep the shares of failed provisions for debugging instead of deleting them")
+
+	sharepollinterval    = flag.Duration("sharepollinterval", sfs.DefaultBackoff.Duration, "Initial interval of polling share status")
+	sharepollfactor      = flag.Float64("sharepollfactor", sfs.DefaultBackoff.Factor, "Factor multiplying the interval of polling share status after each poll")
+	sharepollmaxinterval = flag.Duration("sharepollmaxinterval", sfs.DefaultBackoff.Cap, "Maximum interval of polling share status")
+
+	accessreconcileperiod  = flag.Duration("accessreconcileperiod", 10*time.Minute, "Interval of repairing the access rules of the shares of bound volumes, 0 disables the reconcile")
+	revokeundeclaredaccess = flag.Bool("revokeundeclaredaccess", false, "Revoke the access rules of shares which are not declared by the storage class")
+
+	clusterid         = flag.String("clusterid", "", "The ID of the cluster written into the metadata of the shares")
+	orphanperiod      = flag.Duration("orphanperiod", time.Hour, "Interval of looking for shares of the cluster not referenced by a volume, 0 disables the collector. Requires clusterid")
+	orphangraceperiod = flag.Duration("orphangraceperiod", 24*time.Hour, "Time a share must be orphaned before it is deleted")
+	deleteorphans     = flag.Bool("deleteorphans", false, "Delete the shares orphaned for the grace period instead of only reporting them")
+	orphandryrun      = flag.Bool("orphandryrun", false, "Only log the orphaned shares which would be deleted")
+	recycleretention  = flag.Duration("recycleretention", 0, "Time the shares of deleted volumes are kept in the recycle bin before they are deleted, 0 deletes them immediately")
+	recycleperiod     = flag.Duration("recycleperiod", time.Hour, "Interval of deleting the shares of the recycle bin whose retention expired")
+
+	metricsport    = flag.Int("metricsport", controller.DefaultMetricsPort, "Port of the prometheus metrics endpoint, 0 disables the endpoint")
+	metricsaddress = flag.String("metricsaddress", controller.DefaultMetricsAddress, "Address of the prometheus metrics endpoint")
+	metricspath    = flag.String("metricspath", controller.DefaultMetricsPath, "Path of the prometheus metrics endpoint")
 )
 
 func main() {
@@ -72,9 +98,26 @@ func main() {
 		glog.Fatalf("Failed to create client: %v", err)
 	}
 
-	cc, err := config.LoadConfig(*cloudconfig)
-	if err != nil {
-		glog.Fatalf("Failed to load cloud config: %v", err)
+	// load cloud config and reload it on rotation
+	var cc *config.Store
+	if *cloudconfigsecret != "" {
+		namespace, name, err := cache.SplitMetaNamespaceKey(*cloudconfigsecret)
+		if err != nil || namespace == "" {
+			glog.Fatalf("Invalid cloud config secret %s, must be namespace/name", *cloudconfigsecret)
+		}
+		cc, err = config.NewStoreFromSecret(clientset, namespace, name)
+		if err != nil {
+			glog.Fatalf("Failed to load cloud config: %v", err)
+		}
+		go cc.WatchSecret(clientset, namespace, name, wait.NeverStop)
+	} else {
+		cc, err = config.NewStoreFromFile(*cloudconfig)
+		if err != nil {
+			glog.Fatalf("Failed to load cloud config: %v", err)
+		}
+		if *cloudconfigresync > 0 {
+			go cc.WatchFile(*cloudconfig, *cloudconfigresync, wait.NeverStop)
+		}
 	}
 
 	// The controller needs to know what the server version is because out-of-tree
@@ -87,12 +130,51 @@ func main() {
 	glog.Infof("Get informations. server version: %s share time out: %d",
 		serverVersion.GitVersion, *sharetimeout)
 
+	sfsProvisioner := sfs.NewProvisioner(clientset, *provisioner, cc, *sharetimeout, *vpcid,
+		sfs.KeepFailedShares(*keepfailedshares),
+		sfs.ClusterID(*clusterid),
+		sfs.RecycleRetention(*recycleretention),
+		sfs.ShareBackoff(sfs.Backoff{
+			Duration: *sharepollinterval,
+			Factor:   *sharepollfactor,
+			Cap:      *sharepollmaxinterval,
+		}),
+	)
+
+	// resolve the vpcs of the nodes granted access to the shares,
+	// shares must not be provisioned before the vpcs of the existing nodes are known
+	go sfsProvisioner.DiscoverVPCs(wait.NeverStop)
+	if !sfsProvisioner.WaitForVPCs(wait.NeverStop) {
+		glog.Fatal("Failed to resolve the vpcs of the nodes")
+	}
+
+	// delete the shares of the recycle bin whose retention expired
+	if *recycleretention > 0 {
+		go sfs.NewRecycleBin(sfsProvisioner).Run(*recycleperiod, wait.NeverStop)
+	}
+
+	// report and delete the shares of the cluster which are not referenced by a volume
+	if *orphanperiod > 0 {
+		go sfs.NewShareCollector(sfsProvisioner, *orphangraceperiod, *deleteorphans, *orphandryrun).Run(*orphanperiod, wait.NeverStop)
+	}
+
 	provisionController := controller.NewProvisionController(
 		clientset,
 		*provisioner,
-		sfs.NewProvisioner(clientset, cc, *sharetimeout, *vpcid),
+		sfsProvisioner,
 		serverVersion.GitVersion,
+		controller.MetricsPort(int32(*metricsport)),
+		controller.MetricsAddress(*metricsaddress),
+		controller.MetricsPath(*metricspath),
 	)
 
+	// expand shares of claims whose storage request grows
+	go sfs.NewResizeController(sfsProvisioner).Run(wait.NeverStop)
+
+	// keep the access rules of shares in sync with their storage classes
+	if *accessreconcileperiod > 0 {
+		go sfs.NewAccessReconciler(sfsProvisioner, *revokeundeclaredaccess).Run(*accessreconcileperiod, wait.NeverStop)
+	}
+
 	provisionController.Run(wait.NeverStop)
 }
@@ -0,0 +1,415 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+)
+
+// cli holds the clients of the commands
+type cli struct {
+	clientset kubernetes.Interface
+	cc        *config.Store
+	clients   map[string]*golangsdk.ServiceClient
+}
+
+// newCLIWithClients creates the commands of the clients
+func newCLIWithClients(clientset kubernetes.Interface, cc *config.Store) *cli {
+	return &cli{clientset: clientset, cc: cc, clients: map[string]*golangsdk.ServiceClient{}}
+}
+
+// sfsClient returns the sfs client of the cloud config
+func (c *cli) sfsClient() (*golangsdk.ServiceClient, error) {
+	return c.volumeClient(nil)
+}
+
+// volumeClient returns the sfs client of the credentials owning the share of the volume,
+// which are the ones of the class secret recorded by the provisioner or the cloud config.
+func (c *cli) volumeClient(pv *v1.PersistentVolume) (*golangsdk.ServiceClient, error) {
+	var namespace, name string
+	if pv != nil {
+		namespace = pv.Annotations[sfs.SFSAnnotationSecretNamespace]
+		name = pv.Annotations[sfs.SFSAnnotationSecretName]
+	}
+	key := namespace + "/" + name
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+
+	cc := c.cc
+	if namespace != "" && name != "" {
+		var err error
+		cc, err = config.NewStoreFromSecret(c.clientset, namespace, name)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load credentials of secret %s: %v", key, err)
+		}
+	}
+	client, err := cc.Get().SFSV2Client()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create SFS v2 client: %v", err)
+	}
+	c.clients[key] = client
+	return client, nil
+}
+
+// volumeShareID returns the id of the share of a volume of the provisioner or the csi plugin
+func volumeShareID(pv *v1.PersistentVolume) string {
+	if id := pv.Annotations[sfs.SFSAnnotationID]; id != "" {
+		return id
+	}
+	if pv.Spec.CSI != nil && pv.Spec.CSI.Driver == *drivername {
+		return pv.Spec.CSI.VolumeHandle
+	}
+	return ""
+}
+
+// shareVolumes returns the volumes of the shares by share id
+func (c *cli) shareVolumes() (map[string]*v1.PersistentVolume, error) {
+	pvs, err := c.clientset.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list persistent volumes: %v", err)
+	}
+	volumes := map[string]*v1.PersistentVolume{}
+	for i := range pvs.Items {
+		if id := volumeShareID(&pvs.Items[i]); id != "" {
+			volumes[id] = &pvs.Items[i]
+		}
+	}
+	return volumes, nil
+}
+
+// shareNote returns why a share not used by a volume is no orphan of the cluster,
+// which is a share of the recycle bin or of another cluster, empty if it is an orphan
+func shareNote(share *shares.Share, clusterID string) string {
+	if at := share.Metadata[sfs.SFSMetadataRecycledAt]; at != "" {
+		return "recycled at " + at
+	}
+	if id := share.Metadata[sfs.SFSMetadataClusterID]; clusterID != "" && id != clusterID {
+		if id == "" {
+			return "not tagged with the cluster"
+		}
+		return "tagged with cluster " + id
+	}
+	return ""
+}
+
+// newShareInfo describes the share and the volume using it
+func newShareInfo(share *shares.Share, pv *v1.PersistentVolume) shareInfo {
+	info := shareInfo{
+		ID:       share.ID,
+		Name:     share.Name,
+		Protocol: share.ShareProto,
+		Size:     share.Size,
+		Status:   share.Status,
+		Zone:     share.AvailabilityZone,
+		Note:     shareNote(share, ""),
+	}
+	if pv != nil {
+		info.PV = pv.Name
+		info.PVC = claimName(pv)
+	}
+	return info
+}
+
+// claimName returns the namespace/name of the claim bound to the volume
+func claimName(pv *v1.PersistentVolume) string {
+	if ref := pv.Spec.ClaimRef; ref != nil {
+		return ref.Namespace + "/" + ref.Name
+	}
+	return ""
+}
+
+// list the shares with their volumes and claims
+func (c *cli) list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	fs.Parse(args)
+
+	client, err := c.sfsClient()
+	if err != nil {
+		return err
+	}
+	list, err := sfs.ListShares(client, shares.ListOpts{})
+	if err != nil {
+		return fmt.Errorf("Failed to list shares: %v", err)
+	}
+	volumes, err := c.shareVolumes()
+	if err != nil {
+		return err
+	}
+
+	infos := shareInfos{}
+	for i := range list {
+		infos = append(infos, newShareInfo(&list[i], volumes[list[i].ID]))
+	}
+	return printOutput(os.Stdout, *output, infos)
+}
+
+// describe the share of a claim
+func (c *cli) describe(args []string) error {
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: %s", usageDescribe)
+	}
+	namespace, name, err := cache.SplitMetaNamespaceKey(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("Invalid claim %s: %v", fs.Arg(0), err)
+	}
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	pvc, err := c.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to get claim %s/%s: %v", namespace, name, err)
+	}
+	if pvc.Spec.VolumeName == "" {
+		return fmt.Errorf("Claim %s/%s is not bound", namespace, name)
+	}
+	pv, err := c.clientset.CoreV1().PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to get persistent volume %s: %v", pvc.Spec.VolumeName, err)
+	}
+	shareID := volumeShareID(pv)
+	if shareID == "" {
+		return fmt.Errorf("Persistent volume %s is not a sfs volume", pv.Name)
+	}
+
+	client, err := c.volumeClient(pv)
+	if err != nil {
+		return err
+	}
+	share, err := sfs.GetShare(client, shareID)
+	if err != nil {
+		return fmt.Errorf("Failed to get share %s: %v", shareID, err)
+	}
+	locations, err := sfs.GetShareLocations(client, share)
+	if err != nil {
+		return fmt.Errorf("Failed to get export locations of share %s: %v", shareID, err)
+	}
+	rights, err := shares.ListAccessRights(client, shareID).ExtractAccessRights()
+	if err != nil {
+		return fmt.Errorf("Failed to list access rules of share %s: %v", shareID, err)
+	}
+
+	detail := &shareDetail{
+		Share:           newShareInfo(share, pv),
+		ExportLocations: locations,
+		AccessRules:     []accessRule{},
+	}
+	for _, right := range rights {
+		detail.AccessRules = append(detail.AccessRules, accessRule{
+			ID:    right.ID,
+			Type:  right.AccessType,
+			To:    right.AccessTo,
+			Level: right.AccessLevel,
+			State: right.State,
+		})
+	}
+	return printOutput(os.Stdout, *output, detail)
+}
+
+// orphans finds the shares not used by a volume and the volumes whose share is gone
+func (c *cli) orphans(args []string) error {
+	fs := flag.NewFlagSet("orphans", flag.ExitOnError)
+	clusterID := fs.String("clusterid", "", "Only report the shares tagged with the ID of the cluster")
+	fs.Parse(args)
+
+	client, err := c.sfsClient()
+	if err != nil {
+		return err
+	}
+	list, err := sfs.ListShares(client, shares.ListOpts{})
+	if err != nil {
+		return fmt.Errorf("Failed to list shares: %v", err)
+	}
+	// list the volumes after the shares, so that a share created meanwhile is used
+	volumes, err := c.shareVolumes()
+	if err != nil {
+		return err
+	}
+
+	report := &orphanReport{Shares: shareInfos{}, Volumes: []danglingVolume{}}
+	existing := map[string]bool{}
+	for i := range list {
+		share := &list[i]
+		existing[share.ID] = true
+		if volumes[share.ID] != nil {
+			continue
+		}
+		// skip the shares of other clusters, shares of the recycle bin are labeled by their note
+		if *clusterID != "" && share.Metadata[sfs.SFSMetadataClusterID] != *clusterID {
+			continue
+		}
+		report.Shares = append(report.Shares, newShareInfo(share, nil))
+	}
+
+	for shareID, pv := range volumes {
+		if existing[shareID] {
+			continue
+		}
+		// the share of the credentials of a class secret is not in the listed project
+		if pv.Annotations[sfs.SFSAnnotationSecretName] != "" {
+			volClient, err := c.volumeClient(pv)
+			if err != nil {
+				return err
+			}
+			_, err = sfs.GetShare(volClient, shareID)
+			if err == nil {
+				continue
+			}
+			if _, ok := err.(golangsdk.ErrDefault404); !ok {
+				return fmt.Errorf("Failed to get share %s: %v", shareID, err)
+			}
+		}
+		report.Volumes = append(report.Volumes, danglingVolume{
+			PV:      pv.Name,
+			PVC:     claimName(pv),
+			ShareID: shareID,
+		})
+	}
+	return printOutput(os.Stdout, *output, report)
+}
+
+// expand a share which is not used by a volume, the claims of volumes are expanded instead
+func (c *cli) expand(args []string) error {
+	fs := flag.NewFlagSet("expand", flag.ExitOnError)
+	force := fs.Bool("force", false, "Expand the share even if it is used by a persistent volume, recycled or of another cluster")
+	clusterID := fs.String("clusterid", "", "Refuse the shares not tagged with the ID of the cluster")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("Usage: %s", usageExpand)
+	}
+	shareID := fs.Arg(0)
+	size, err := strconv.Atoi(fs.Arg(1))
+	if err != nil || size <= 0 {
+		return fmt.Errorf("Invalid size %s, must be a positive number of GB", fs.Arg(1))
+	}
+
+	client, err := c.checkedShareClient(shareID, *clusterID, *force, "expand the claim instead")
+	if err != nil {
+		return err
+	}
+	share, err := sfs.GetShare(client, shareID)
+	if err != nil {
+		return fmt.Errorf("Failed to get share %s: %v", shareID, err)
+	}
+	if share.Status != sfs.SFSStatusAvailable {
+		return fmt.Errorf("Share %s is %s instead of %s", shareID, share.Status, sfs.SFSStatusAvailable)
+	}
+	if size <= share.Size {
+		return fmt.Errorf("Share %s of %dGB can not be shrunk to %dGB", shareID, share.Size, size)
+	}
+
+	fmt.Printf("Expand share %s from %dGB to %dGB\n", shareID, share.Size, size)
+	if err := sfs.ExpandShare(client, shareID, size); err != nil {
+		return fmt.Errorf("Failed to expand share %s: %v", shareID, err)
+	}
+	ctx, cancel := shareContext()
+	defer cancel()
+	if err := sfs.WaitForShareStatus(ctx, client, shareID, sfs.SFSStatusAvailable, sfs.DefaultBackoff); err != nil {
+		return fmt.Errorf("Waiting for share %s to be expanded failed: %v", shareID, err)
+	}
+	share, err = sfs.GetShare(client, shareID)
+	if err != nil {
+		return fmt.Errorf("Failed to get share %s: %v", shareID, err)
+	}
+	if share.Size < size {
+		return fmt.Errorf("Share %s is available with %dGB instead of %dGB", shareID, share.Size, size)
+	}
+	fmt.Printf("Share %s expanded\n", shareID)
+	return nil
+}
+
+// delete a share which is not used by a volume
+func (c *cli) delete(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	force := fs.Bool("force", false, "Delete the share even if it is used by a persistent volume, recycled or of another cluster")
+	clusterID := fs.String("clusterid", "", "Refuse the shares not tagged with the ID of the cluster")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("Usage: %s", usageDelete)
+	}
+	shareID := fs.Arg(0)
+
+	client, err := c.checkedShareClient(shareID, *clusterID, *force, "delete the claim instead")
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Delete share %s\n", shareID)
+	ctx, cancel := shareContext()
+	defer cancel()
+	if err := sfs.DeleteShareAndWait(ctx, client, shareID, sfs.DefaultBackoff); err != nil {
+		return fmt.Errorf("Failed to delete share %s: %v", shareID, err)
+	}
+	fmt.Printf("Share %s deleted\n", shareID)
+	return nil
+}
+
+// checkedShareClient returns the client of the share, shares used by a volume, of the recycle bin
+// or of another cluster are refused unless forced
+func (c *cli) checkedShareClient(shareID, clusterID string, force bool, hint string) (*golangsdk.ServiceClient, error) {
+	volumes, err := c.shareVolumes()
+	if err != nil {
+		return nil, err
+	}
+	pv := volumes[shareID]
+	if pv != nil {
+		if !force {
+			return nil, fmt.Errorf("Share %s is used by persistent volume %s of claim %s, %s or use -force",
+				shareID, pv.Name, claimName(pv), hint)
+		}
+		return c.volumeClient(pv)
+	}
+
+	client, err := c.sfsClient()
+	if err != nil {
+		return nil, err
+	}
+	if force {
+		return client, nil
+	}
+	share, err := sfs.GetShare(client, shareID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get share %s: %v", shareID, err)
+	}
+	if note := shareNote(share, clusterID); note != "" {
+		return nil, fmt.Errorf("Share %s is %s, use -force", shareID, note)
+	}
+	return client, nil
+}
+
+// shareContext returns a context which expires after the share timeout
+func shareContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(*timeout)*time.Second)
+}
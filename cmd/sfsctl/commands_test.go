@@ -0,0 +1,121 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/external-sfs/pkg/driver"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+)
+
+func TestVolumeShareID(t *testing.T) {
+	tests := []struct {
+		name string
+		pv   *v1.PersistentVolume
+		id   string
+	}{
+		{
+			name: "provisioner volume",
+			pv: &v1.PersistentVolume{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{sfs.SFSAnnotationID: "share-1"}},
+			},
+			id: "share-1",
+		},
+		{
+			name: "csi volume",
+			pv: &v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: driver.DriverName, VolumeHandle: "share-2"},
+			}}},
+			id: "share-2",
+		},
+		{
+			name: "csi volume of another driver",
+			pv: &v1.PersistentVolume{Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{Driver: "other.csi.k8s.io", VolumeHandle: "volume-1"},
+			}}},
+			id: "",
+		},
+		{
+			name: "other volume",
+			pv:   &v1.PersistentVolume{},
+			id:   "",
+		},
+	}
+
+	for _, test := range tests {
+		if id := volumeShareID(test.pv); id != test.id {
+			t.Errorf("%s: expected share id %q, got %q", test.name, test.id, id)
+		}
+	}
+}
+
+func TestCheckedShareClient(t *testing.T) {
+	cloud := fake.NewCloud()
+	defer cloud.Close()
+	for id, metadata := range map[string]map[string]string{
+		"used":     {sfs.SFSMetadataClusterID: "cluster"},
+		"orphan":   {sfs.SFSMetadataClusterID: "cluster"},
+		"recycled": {sfs.SFSMetadataClusterID: "cluster", sfs.SFSMetadataRecycledAt: "2018-10-01T00:00:00Z"},
+		"other":    {sfs.SFSMetadataClusterID: "other"},
+		"untagged": {},
+	} {
+		cloud.AddShare(&fake.Share{Share: shares.Share{ID: id, Status: sfs.SFSStatusAvailable, Metadata: metadata}})
+	}
+
+	api := fake.NewAPIServer(&v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pv-1",
+			Annotations: map[string]string{sfs.SFSAnnotationID: "used"},
+		},
+		Spec: v1.PersistentVolumeSpec{ClaimRef: &v1.ObjectReference{Namespace: "default", Name: "claim-1"}},
+	})
+	defer api.Close()
+	c := newCLIWithClients(api.Clientset(), config.NewStore(cloud.Credentials()))
+
+	tests := []struct {
+		shareID   string
+		clusterID string
+		force     bool
+		allowed   bool
+	}{
+		{shareID: "used", force: false, allowed: false},
+		{shareID: "used", force: true, allowed: true},
+		{shareID: "orphan", clusterID: "cluster", force: false, allowed: true},
+		{shareID: "recycled", clusterID: "cluster", force: false, allowed: false},
+		{shareID: "recycled", force: true, allowed: true},
+		{shareID: "other", clusterID: "cluster", force: false, allowed: false},
+		{shareID: "other", force: false, allowed: true},
+		{shareID: "untagged", clusterID: "cluster", force: false, allowed: false},
+		{shareID: "untagged", clusterID: "cluster", force: true, allowed: true},
+		{shareID: "missing", force: false, allowed: false},
+	}
+
+	for _, test := range tests {
+		client, err := c.checkedShareClient(test.shareID, test.clusterID, test.force, "hint")
+		if allowed := err == nil && client != nil; allowed != test.allowed {
+			t.Errorf("Share %s of cluster %q with force %v: expected allowed %v, got %v",
+				test.shareID, test.clusterID, test.force, test.allowed, err)
+		}
+	}
+}
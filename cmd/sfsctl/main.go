@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/external-sfs/pkg/driver"
+)
+
+var (
+	master      = flag.String("master", "", "Master URL to build a client config from")
+	kubeconfig  = flag.String("kubeconfig", "", "Absolute path to the kubeconfig file, defaults to KUBECONFIG or ~/.kube/config")
+	cloudconfig = flag.String("cloudconfig", "/etc/origin/cloudprovider/openstack.conf", "Absolute path to the cloud config")
+	output      = flag.String("o", outputTable, "Output format: table, json or yaml")
+	timeout     = flag.Int("timeout", 600, "Share operation timeout. Unit: second")
+	drivername  = flag.String("drivername", driver.DriverName, "Name of the sfs csi driver of the volumes")
+)
+
+// Defines the usages of the commands
+const (
+	usageList     = "list"
+	usageDescribe = "describe <namespace>/<claim>"
+	usageOrphans  = "orphans [-clusterid <id>]"
+	usageExpand   = "expand [-force] [-clusterid <id>] <share id> <size in GB>"
+	usageDelete   = "delete [-force] [-clusterid <id>] <share id>"
+)
+
+// command of sfsctl
+type command struct {
+	usage       string
+	description string
+	run         func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"list": {
+		usage:       usageList,
+		description: "List the shares with the persistent volumes and claims using them",
+		run:         (*cli).list,
+	},
+	"describe": {
+		usage:       usageDescribe,
+		description: "Show the share, access rules and export locations of a claim",
+		run:         (*cli).describe,
+	},
+	"orphans": {
+		usage:       usageOrphans,
+		description: "Find the shares not used by a persistent volume and the volumes whose share is gone",
+		run:         (*cli).orphans,
+	},
+	"expand": {
+		usage:       usageExpand,
+		description: "Expand a share, shares used by a volume, recycled or of another cluster are only expanded with -force",
+		run:         (*cli).expand,
+	},
+	"delete": {
+		usage:       usageDelete,
+		description: "Delete a share, shares used by a volume, recycled or of another cluster are only deleted with -force",
+		run:         (*cli).delete,
+	},
+}
+
+var commandNames = []string{"list", "describe", "orphans", "expand", "delete"}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command> [command flags] [args]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	for _, name := range commandNames {
+		cmd := commands[name]
+		fmt.Fprintf(os.Stderr, "  %-40s %s\n", cmd.usage, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	if err := validateOutput(*output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	c, err := newCLI()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := cmd.run(c, flag.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newCLI creates the kubernetes client and loads the cloud config
+func newCLI() (*cli, error) {
+	path := *kubeconfig
+	if path == "" {
+		path = os.Getenv("KUBECONFIG")
+	}
+	if path == "" && *master == "" {
+		path = clientcmd.RecommendedHomeFile
+	}
+	restconfig, err := clientcmd.BuildConfigFromFlags(*master, path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create restconfig: %v", err)
+	}
+	clientset, err := kubernetes.NewForConfig(restconfig)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create client: %v", err)
+	}
+
+	cc, err := config.NewStoreFromFile(*cloudconfig)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load cloud config: %v", err)
+	}
+	return newCLIWithClients(clientset, cc), nil
+}
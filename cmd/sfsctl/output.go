@@ -0,0 +1,160 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+)
+
+// Defines the output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// shareInfo describes a share and the volume using it
+type shareInfo struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Size     int    `json:"size"`
+	Status   string `json:"status"`
+	Zone     string `json:"zone"`
+	PV       string `json:"pv,omitempty"`
+	PVC      string `json:"pvc,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// shareInfos is a list of shares
+type shareInfos []shareInfo
+
+// accessRule describes an access rule of a share
+type accessRule struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	To    string `json:"to"`
+	Level string `json:"level"`
+	State string `json:"state"`
+}
+
+// shareDetail describes the share of a claim
+type shareDetail struct {
+	Share           shareInfo    `json:"share"`
+	ExportLocations []string     `json:"exportLocations"`
+	AccessRules     []accessRule `json:"accessRules"`
+}
+
+// danglingVolume is a volume whose share is gone
+type danglingVolume struct {
+	PV      string `json:"pv"`
+	PVC     string `json:"pvc,omitempty"`
+	ShareID string `json:"shareID"`
+}
+
+// orphanReport lists the shares not used by a volume and the volumes whose share is gone
+type orphanReport struct {
+	Shares  shareInfos       `json:"shares"`
+	Volumes []danglingVolume `json:"volumes"`
+}
+
+// tablePrinter prints itself as table
+type tablePrinter interface {
+	printTable(w *tabwriter.Writer)
+}
+
+// validateOutput checks the output format
+func validateOutput(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("Invalid output format %s, must be %s, %s or %s", format, outputTable, outputJSON, outputYAML)
+}
+
+// printOutput prints the object in the output format
+func printOutput(w io.Writer, format string, obj tablePrinter) error {
+	switch format {
+	case outputJSON:
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case outputYAML:
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	obj.printTable(tw)
+	return tw.Flush()
+}
+
+// printRow prints the cells as a row of the table
+func printRow(w *tabwriter.Writer, cells ...string) {
+	for i, cell := range cells {
+		if cell == "" {
+			cells[i] = "<none>"
+		}
+	}
+	fmt.Fprintln(w, strings.Join(cells, "\t"))
+}
+
+func (infos shareInfos) printTable(w *tabwriter.Writer) {
+	printRow(w, "ID", "NAME", "PROTOCOL", "SIZE", "STATUS", "ZONE", "PV", "PVC", "NOTE")
+	for _, s := range infos {
+		printRow(w, s.ID, s.Name, s.Protocol, fmt.Sprintf("%dGB", s.Size), s.Status, s.Zone, s.PV, s.PVC, s.Note)
+	}
+}
+
+func (d *shareDetail) printTable(w *tabwriter.Writer) {
+	shareInfos{d.Share}.printTable(w)
+
+	fmt.Fprintln(w)
+	printRow(w, "EXPORT LOCATION")
+	for _, location := range d.ExportLocations {
+		printRow(w, location)
+	}
+
+	fmt.Fprintln(w)
+	printRow(w, "ACCESS ID", "TYPE", "TO", "LEVEL", "STATE")
+	for _, r := range d.AccessRules {
+		printRow(w, r.ID, r.Type, r.To, r.Level, r.State)
+	}
+}
+
+func (r *orphanReport) printTable(w *tabwriter.Writer) {
+	r.Shares.printTable(w)
+
+	fmt.Fprintln(w)
+	printRow(w, "DANGLING PV", "PVC", "SHARE ID")
+	for _, v := range r.Volumes {
+		printRow(w, v.PV, v.PVC, v.ShareID)
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack"
+
+	"github.com/gophercloud/gophercloud"
+	nativeopenstack "github.com/gophercloud/gophercloud/openstack"
+)
+
+// useAKSK checks whether the requests are signed with access key and secret key
+func (c *CloudCredentials) useAKSK() bool {
+	return c.Global.AccessKey != "" && c.Global.SecretKey != ""
+}
+
+// newAKSKClients returns new cloud clients signing the requests with access key and secret key,
+// the endpoints of the services are derived from the region instead of the keystone catalog.
+func (c *CloudCredentials) newAKSKClients() error {
+	if c.Global.Region == "" {
+		return fmt.Errorf("Region must be provided for AK/SK authentication")
+	}
+
+	signer := &AKSKSigner{
+		AccessKey:     c.Global.AccessKey,
+		SecretKey:     c.Global.SecretKey,
+		SecurityToken: c.Global.SecurityToken,
+	}
+	transport, err := c.newTransport(signer)
+	if err != nil {
+		return err
+	}
+
+	client, err := openstack.NewClient(c.Global.AuthURL)
+	if err != nil {
+		return err
+	}
+	client.HTTPClient = http.Client{Transport: transport}
+
+	// discover project id
+	projectID, err := c.discoverProjectID(client)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Use project %s of region %s", projectID, c.Global.Region)
+	signer.ProjectID = projectID
+	client.ProjectID = projectID
+	c.CloudClient = client
+
+	nativeClient, err := nativeopenstack.NewClient(c.Global.AuthURL)
+	if err != nil {
+		return err
+	}
+	nativeClient.HTTPClient = http.Client{Transport: transport}
+	c.OpenStackClient = nativeClient
+
+	return nil
+}
+
+// discoverProjectID returns the configured project id or the id of the project named after the region
+func (c *CloudCredentials) discoverProjectID(client *golangsdk.ProviderClient) (string, error) {
+	if c.Global.ProjectID != "" {
+		return c.Global.ProjectID, nil
+	}
+	if c.Global.TenantID != "" {
+		return c.Global.TenantID, nil
+	}
+
+	iam := &golangsdk.ServiceClient{
+		ProviderClient: client,
+		Endpoint:       client.IdentityBase + "v3/",
+	}
+	var result struct {
+		Projects []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"projects"`
+	}
+	_, err := iam.Get(iam.ServiceURL("projects")+"?name="+url.QueryEscape(c.Global.Region), &result, nil)
+	if err != nil {
+		return "", fmt.Errorf("Failed to discover project of region %s: %v", c.Global.Region, err)
+	}
+	for _, p := range result.Projects {
+		if p.Name == c.Global.Region {
+			return p.ID, nil
+		}
+	}
+	return "", fmt.Errorf("Failed to discover project of region %s: not found", c.Global.Region)
+}
+
+// cloudDomain returns the configured domain of the cloud or the one of the auth url
+func (c *CloudCredentials) cloudDomain() string {
+	if c.Global.Cloud != "" {
+		return c.Global.Cloud
+	}
+
+	u, err := url.Parse(c.Global.AuthURL)
+	if err != nil {
+		return ""
+	}
+	domain := strings.TrimPrefix(u.Hostname(), "iam.")
+	return strings.TrimPrefix(domain, c.Global.Region+".")
+}
+
+// serviceEndpoint returns the endpoint of the service in the region
+func (c *CloudCredentials) serviceEndpoint(service string) string {
+	return fmt.Sprintf("https://%s.%s.%s/", service, c.Global.Region, c.cloudDomain())
+}
+
+// akskSFSV2Client returns the sfs v2 client of AK/SK authentication
+func (c *CloudCredentials) akskSFSV2Client() *golangsdk.ServiceClient {
+	return &golangsdk.ServiceClient{
+		ProviderClient: c.CloudClient,
+		Endpoint:       c.serviceEndpoint("sfs") + "v2/" + c.CloudClient.ProjectID + "/",
+		Type:           "sharev2",
+	}
+}
+
+// akskNetworkingV1Client returns the networking v1 client of AK/SK authentication
+func (c *CloudCredentials) akskNetworkingV1Client() *golangsdk.ServiceClient {
+	endpoint := c.serviceEndpoint("vpc")
+	return &golangsdk.ServiceClient{
+		ProviderClient: c.CloudClient,
+		Endpoint:       endpoint,
+		ResourceBase:   endpoint + "v1/",
+		Type:           "network",
+	}
+}
+
+// akskComputeV2Client returns the compute v2 client of AK/SK authentication
+func (c *CloudCredentials) akskComputeV2Client() *gophercloud.ServiceClient {
+	return &gophercloud.ServiceClient{
+		ProviderClient: c.OpenStackClient,
+		Endpoint:       c.serviceEndpoint("ecs") + "v2.1/" + c.CloudClient.ProjectID + "/",
+		Type:           "compute",
+	}
+}
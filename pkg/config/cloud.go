@@ -45,6 +45,9 @@ type CloudCredentials struct {
 		Region         string
 		AccessKey      string `gcfg:"access-key"`
 		SecretKey      string `gcfg:"secret-key"`
+		SecurityToken  string `gcfg:"security-token"`
+		ProjectID      string `gcfg:"project-id"`
+		Cloud          string
 		CACertFile     string `gcfg:"cacert-file"`
 		ClientCertFile string `gcfg:"cert"`
 		ClientKeyFile  string `gcfg:"key"`
@@ -76,6 +79,11 @@ func (c *CloudCredentials) Validate() error {
 		return fmt.Errorf("Invalid endpoint type provided")
 	}
 
+	// prefer signed requests to passwords
+	if c.useAKSK() {
+		return c.newAKSKClients()
+	}
+
 	err := c.newCloudClient()
 	if err != nil {
 		return err
@@ -104,54 +112,11 @@ func (c *CloudCredentials) newCloudClient() error {
 		return err
 	}
 
-	config := &tls.Config{}
-	if c.Global.CACertFile != "" {
-		caCert, _, err := ReadContents(c.Global.CACertFile)
-		if err != nil {
-			return fmt.Errorf("Error reading CA Cert: %s", err)
-		}
-
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM([]byte(caCert))
-		config.RootCAs = caCertPool
-	}
-
-	if c.Global.Insecure {
-		config.InsecureSkipVerify = true
-	}
-
-	if c.Global.ClientCertFile != "" && c.Global.ClientKeyFile != "" {
-		clientCert, _, err := ReadContents(c.Global.ClientCertFile)
-		if err != nil {
-			return fmt.Errorf("Error reading Client Cert: %s", err)
-		}
-		clientKey, _, err := ReadContents(c.Global.ClientKeyFile)
-		if err != nil {
-			return fmt.Errorf("Error reading Client Key: %s", err)
-		}
-
-		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
-		if err != nil {
-			return err
-		}
-
-		config.Certificates = []tls.Certificate{cert}
-		config.BuildNameToCertificate()
-	}
-
-	// if OS_DEBUG is set, log the requests and responses
-	var osDebug bool
-	if os.Getenv("OS_DEBUG") != "" {
-		osDebug = true
-	}
-
-	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}
-	client.HTTPClient = http.Client{
-		Transport: &logger.LogRoundTripper{
-			Rt:      transport,
-			OsDebug: osDebug,
-		},
+	transport, err := c.newTransport(nil)
+	if err != nil {
+		return err
 	}
+	client.HTTPClient = http.Client{Transport: transport}
 
 	err = openstack.Authenticate(client, ao)
 	if err != nil {
@@ -183,11 +148,29 @@ func (c *CloudCredentials) newOpenStackClient() error {
 		return err
 	}
 
+	transport, err := c.newTransport(nil)
+	if err != nil {
+		return err
+	}
+	client.HTTPClient = http.Client{Transport: transport}
+
+	err = nativeopenstack.Authenticate(client, ao)
+	if err != nil {
+		return err
+	}
+
+	c.OpenStackClient = client
+
+	return nil
+}
+
+// newTransport returns the http transport of the cloud clients
+func (c *CloudCredentials) newTransport(signer *AKSKSigner) (http.RoundTripper, error) {
 	config := &tls.Config{}
 	if c.Global.CACertFile != "" {
 		caCert, _, err := ReadContents(c.Global.CACertFile)
 		if err != nil {
-			return fmt.Errorf("Error reading CA Cert: %s", err)
+			return nil, fmt.Errorf("Error reading CA Cert: %s", err)
 		}
 
 		caCertPool := x509.NewCertPool()
@@ -202,16 +185,16 @@ func (c *CloudCredentials) newOpenStackClient() error {
 	if c.Global.ClientCertFile != "" && c.Global.ClientKeyFile != "" {
 		clientCert, _, err := ReadContents(c.Global.ClientCertFile)
 		if err != nil {
-			return fmt.Errorf("Error reading Client Cert: %s", err)
+			return nil, fmt.Errorf("Error reading Client Cert: %s", err)
 		}
 		clientKey, _, err := ReadContents(c.Global.ClientKeyFile)
 		if err != nil {
-			return fmt.Errorf("Error reading Client Key: %s", err)
+			return nil, fmt.Errorf("Error reading Client Key: %s", err)
 		}
 
 		cert, err := tls.X509KeyPair([]byte(clientCert), []byte(clientKey))
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		config.Certificates = []tls.Certificate{cert}
@@ -224,22 +207,21 @@ func (c *CloudCredentials) newOpenStackClient() error {
 		osDebug = true
 	}
 
-	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}
-	client.HTTPClient = http.Client{
-		Transport: &logger.LogRoundTripper{
-			Rt:      transport,
-			OsDebug: osDebug,
-		},
-	}
+	var transport http.RoundTripper = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}
 
-	err = nativeopenstack.Authenticate(client, ao)
-	if err != nil {
-		return err
+	// sign the requests if a signer is given
+	if signer != nil {
+		signer.Rt = transport
+		transport = signer
 	}
 
-	c.OpenStackClient = client
+	// record the metrics of the requests
+	transport = &metricsRoundTripper{rt: transport}
 
-	return nil
+	return &logger.LogRoundTripper{
+		Rt:      transport,
+		OsDebug: osDebug,
+	}, nil
 }
 
 // getEndpointType returns cloud endpoint type
@@ -266,6 +248,9 @@ func (c *CloudCredentials) getNativeEndpointType() gophercloud.Availability {
 
 // SFSV2Client return sfs v2 client
 func (c *CloudCredentials) SFSV2Client() (*golangsdk.ServiceClient, error) {
+	if c.useAKSK() {
+		return c.akskSFSV2Client(), nil
+	}
 	return openstack.NewSharedFileSystemV2(c.CloudClient, golangsdk.EndpointOpts{
 		Region:       c.Global.Region,
 		Availability: c.getEndpointType(),
@@ -274,6 +259,9 @@ func (c *CloudCredentials) SFSV2Client() (*golangsdk.ServiceClient, error) {
 
 // NetworkingV1Client return native networking v1 client
 func (c *CloudCredentials) NetworkingV1Client() (*golangsdk.ServiceClient, error) {
+	if c.useAKSK() {
+		return c.akskNetworkingV1Client(), nil
+	}
 	return openstack.NewNetworkV1(c.CloudClient, golangsdk.EndpointOpts{
 		Region:       c.Global.Region,
 		Availability: c.getEndpointType(),
@@ -282,6 +270,9 @@ func (c *CloudCredentials) NetworkingV1Client() (*golangsdk.ServiceClient, error
 
 // ComputeV2Client return native compute v2 client
 func (c *CloudCredentials) ComputeV2Client() (*gophercloud.ServiceClient, error) {
+	if c.useAKSK() {
+		return c.akskComputeV2Client(), nil
+	}
 	return nativeopenstack.NewComputeV2(c.OpenStackClient, gophercloud.EndpointOpts{
 		Region:       c.Global.Region,
 		Availability: c.getNativeEndpointType(),
@@ -54,3 +54,20 @@ func LoadConfig(configFile string) (cc CloudCredentials, err error) {
 
 	return cc, nil
 }
+
+// LoadConfigFromBytes of a secret or a projected file
+func LoadConfigFromBytes(data []byte) (cc CloudCredentials, err error) {
+	// Read configuration
+	err = gcfg.FatalOnly(gcfg.ReadStringInto(&cc, string(data)))
+	if err != nil {
+		return cc, err
+	}
+
+	// Validate configuration
+	err = cc.Validate()
+	if err != nil {
+		return cc, err
+	}
+
+	return cc, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsSubsystem is the prometheus subsystem of the cloud api metrics
+const metricsSubsystem = "sfs"
+
+var (
+	// apiRequestsTotal counts the requests to the cloud apis
+	apiRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "api_requests_total",
+			Help:      "Total number of requests to the cloud apis. Broken down by service, method, endpoint and status code.",
+		},
+		[]string{"service", "method", "endpoint", "code"},
+	)
+	// apiRequestDuration observes the latencies of the requests to the cloud apis
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "api_request_duration_seconds",
+			Help:      "Latency of the requests to the cloud apis. Broken down by service, method and endpoint.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+		},
+		[]string{"service", "method", "endpoint"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(apiRequestDuration, apiRequestsTotal)
+}
+
+// idSegment matches the path segments of resource and project ids
+var idSegment = regexp.MustCompile(`^([0-9a-fA-F]{32}|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+// metricsRoundTripper satisfies the http.RoundTripper interface and records
+// the count, status codes and latency of the requests per endpoint.
+type metricsRoundTripper struct {
+	rt http.RoundTripper
+}
+
+// RoundTrip performs the round-trip and records its metrics
+func (m *metricsRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	service, endpoint := requestEndpoint(request)
+	start := time.Now()
+	response, err := m.rt.RoundTrip(request)
+	apiRequestDuration.WithLabelValues(service, request.Method, endpoint).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil && response != nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+	apiRequestsTotal.WithLabelValues(service, request.Method, endpoint, code).Inc()
+	return response, err
+}
+
+// requestEndpoint returns the service named by the host and the path of the request,
+// in which the ids are replaced so that the requests of all resources share an endpoint
+func requestEndpoint(request *http.Request) (string, string) {
+	service := request.URL.Hostname()
+	if net.ParseIP(service) == nil {
+		service = strings.SplitN(service, ".", 2)[0]
+	}
+	segments := strings.Split(request.URL.Path, "/")
+	for i, s := range segments {
+		if idSegment.MatchString(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return service, strings.Join(segments, "/")
+}
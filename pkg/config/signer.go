@@ -0,0 +1,211 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defines signing constants
+const (
+	signAlgorithm       = "SDK-HMAC-SHA256"
+	signDateFormat      = "20060102T150405Z"
+	headerSignDate      = "X-Sdk-Date"
+	headerProjectID     = "X-Project-Id"
+	headerSecurityToken = "X-Security-Token"
+	headerAuthorization = "Authorization"
+)
+
+// AKSKSigner satisfies the http.RoundTripper interface and signs
+// every request with the access key and secret key.
+type AKSKSigner struct {
+	Rt            http.RoundTripper
+	AccessKey     string
+	SecretKey     string
+	SecurityToken string
+	ProjectID     string
+}
+
+// RoundTrip signs the request and performs the round-trip
+func (s *AKSKSigner) RoundTrip(request *http.Request) (*http.Response, error) {
+	// sign a copy, the original request must not be modified
+	signed := new(http.Request)
+	*signed = *request
+	signed.Header = make(http.Header, len(request.Header))
+	for k, v := range request.Header {
+		signed.Header[k] = v
+	}
+
+	var body []byte
+	if request.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(request.Body)
+		request.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	s.sign(signed, body, time.Now().UTC())
+	return s.Rt.RoundTrip(signed)
+}
+
+// sign adds the signature headers to the request
+func (s *AKSKSigner) sign(r *http.Request, body []byte, now time.Time) {
+	r.Header.Set(headerSignDate, now.Format(signDateFormat))
+	if s.ProjectID != "" {
+		r.Header.Set(headerProjectID, s.ProjectID)
+	}
+	if s.SecurityToken != "" {
+		r.Header.Set(headerSecurityToken, s.SecurityToken)
+	}
+	r.Header.Del(headerAuthorization)
+
+	signedHeaders := signedHeaderNames(r)
+	stringToSign := strings.Join([]string{
+		signAlgorithm,
+		r.Header.Get(headerSignDate),
+		hexSHA256([]byte(canonicalRequest(r, body, signedHeaders))),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(s.SecretKey))
+	mac.Write([]byte(stringToSign))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	r.Header.Set(headerAuthorization, fmt.Sprintf("%s Access=%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, s.AccessKey, strings.Join(signedHeaders, ";"), signature))
+}
+
+// canonicalRequest returns the method, uri, query, headers and body hash of the request in canonical form
+func canonicalRequest(r *http.Request, body []byte, signedHeaders []string) string {
+	return strings.Join([]string{
+		r.Method,
+		canonicalURI(r),
+		canonicalQueryString(r),
+		canonicalHeaders(r, signedHeaders),
+		strings.Join(signedHeaders, ";"),
+		hexSHA256(body),
+	}, "\n")
+}
+
+// signedHeaderNames returns the sorted lower case names of the headers to sign
+func signedHeaderNames(r *http.Request) []string {
+	names := []string{"host"}
+	for k := range r.Header {
+		name := strings.ToLower(k)
+		if name == "host" || name == "user-agent" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canonicalURI returns the escaped path ending with a slash
+func canonicalURI(r *http.Request) string {
+	segments := strings.Split(r.URL.Path, "/")
+	for i, s := range segments {
+		segments[i] = signEscape(s)
+	}
+	uri := strings.Join(segments, "/")
+	if !strings.HasSuffix(uri, "/") {
+		uri += "/"
+	}
+	return uri
+}
+
+// canonicalQueryString returns the escaped query sorted by key and value
+func canonicalQueryString(r *http.Request) string {
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, signEscape(k)+"="+signEscape(v))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// canonicalHeaders returns the signed headers in canonical form,
+// a header with several values has a line per value sorted by value
+func canonicalHeaders(r *http.Request, names []string) string {
+	headers := map[string][]string{}
+	for k, v := range r.Header {
+		name := strings.ToLower(k)
+		headers[name] = append(headers[name], v...)
+	}
+
+	var lines []string
+	for _, name := range names {
+		values := append([]string(nil), headers[name]...)
+		if name == "host" {
+			host := r.Host
+			if host == "" {
+				host = r.URL.Host
+			}
+			values = []string{host}
+		}
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			lines = append(lines, name+":"+value)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// signEscape escapes all characters except the unreserved ones of RFC 3986
+func signEscape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// hexSHA256 returns the hex encoded sha256 of data
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signDate is the date of the signing example of the api signing guide
+var signDate = time.Date(2019, 11, 15, 3, 36, 55, 0, time.UTC)
+
+func newSignRequest(t *testing.T, method, url string) *http.Request {
+	r, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func mustParseURL(t *testing.T, rawurl string) *url.URL {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatalf("Failed to parse url %s: %v", rawurl, err)
+	}
+	return u
+}
+
+func TestSignGuideExample(t *testing.T) {
+	// the canonical request of the example of the api signing guide
+	r := newSignRequest(t, "GET",
+		"https://service.region.example.com/v1/77b6a44cba5143ab91d13ab9a8ff44fd/vpcs?marker=13551d6b-755d-4757-b956-536f674975c0&limit=2")
+	s := &AKSKSigner{AccessKey: "QTWAOYTTINDUT2QVKYUC", SecretKey: "test-secret-key"}
+	s.sign(r, nil, signDate)
+
+	authorization := "SDK-HMAC-SHA256 Access=QTWAOYTTINDUT2QVKYUC, SignedHeaders=content-type;host;x-sdk-date, " +
+		"Signature=3f53cba68e0e59eada130196a921f4797fcc78fded45074c7cbdf203968b92cd"
+	if value := r.Header.Get(headerAuthorization); value != authorization {
+		t.Errorf("Expected authorization %s, got %s", authorization, value)
+	}
+
+	// the authorization is not part of the signed request
+	r.Header.Del(headerAuthorization)
+	expected := strings.Join([]string{
+		"GET",
+		"/v1/77b6a44cba5143ab91d13ab9a8ff44fd/vpcs/",
+		"limit=2&marker=13551d6b-755d-4757-b956-536f674975c0",
+		"content-type:application/json",
+		"host:service.region.example.com",
+		"x-sdk-date:20191115T033655Z",
+		"",
+		"content-type;host;x-sdk-date",
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+	}, "\n")
+	canonical := canonicalRequest(r, nil, signedHeaderNames(r))
+	if canonical != expected {
+		t.Errorf("Expected canonical request\n%s\ngot\n%s", expected, canonical)
+	}
+	if hash := hexSHA256([]byte(canonical)); hash != "b25362e603ee30f4f25e7858e8a7160fd36e803bb2dfe206278659d71a9bcd7a" {
+		t.Errorf("Unexpected canonical request hash %s", hash)
+	}
+}
+
+func TestSignRequestWithBody(t *testing.T) {
+	r := newSignRequest(t, "POST", "https://sfs.region.example.com/v2/project/shares/share-1/action?b=2&a=x%20y&a=1")
+	r.Header.Add("X-Multi", "b")
+	r.Header.Add("X-Multi", "a")
+	r.Header.Set("User-Agent", "golangsdk")
+	body := []byte(`{"os-extend":{"new_size":2}}`)
+	s := &AKSKSigner{AccessKey: "ak", SecretKey: "test-secret-key", ProjectID: "project"}
+	s.sign(r, body, signDate)
+
+	authorization := "SDK-HMAC-SHA256 Access=ak, SignedHeaders=content-type;host;x-multi;x-project-id;x-sdk-date, " +
+		"Signature=93d993795c806e0c357c7660746cfa4cdc680f3ae6271b88b7508f58c8b691ed"
+	if value := r.Header.Get(headerAuthorization); value != authorization {
+		t.Errorf("Expected authorization %s, got %s", authorization, value)
+	}
+
+	r.Header.Del(headerAuthorization)
+	expected := strings.Join([]string{
+		"POST",
+		"/v2/project/shares/share-1/action/",
+		"a=1&a=x%20y&b=2",
+		"content-type:application/json",
+		"host:sfs.region.example.com",
+		"x-multi:a",
+		"x-multi:b",
+		"x-project-id:project",
+		"x-sdk-date:20191115T033655Z",
+		"",
+		"content-type;host;x-multi;x-project-id;x-sdk-date",
+		"319a647f4b156ad26dcf86e365772a996846161d660c1a62382c1070a3571fc9",
+	}, "\n")
+	if canonical := canonicalRequest(r, body, signedHeaderNames(r)); canonical != expected {
+		t.Errorf("Expected canonical request\n%s\ngot\n%s", expected, canonical)
+	}
+}
+
+func TestCanonicalURI(t *testing.T) {
+	tests := []struct {
+		path string
+		uri  string
+	}{
+		{path: "", uri: "/"},
+		{path: "/", uri: "/"},
+		{path: "/v2/project/shares", uri: "/v2/project/shares/"},
+		{path: "/v2/project/shares/", uri: "/v2/project/shares/"},
+		{path: "/v2/project/shares/detail", uri: "/v2/project/shares/detail/"},
+		{path: "/v2/share name/a:b", uri: "/v2/share%20name/a%3Ab/"},
+		{path: "/v2/a~b_c-d.e", uri: "/v2/a~b_c-d.e/"},
+	}
+
+	for _, test := range tests {
+		r := &http.Request{URL: mustParseURL(t, "https://sfs.region.example.com")}
+		r.URL.Path = test.path
+		if uri := canonicalURI(r); uri != test.uri {
+			t.Errorf("%q: expected %s, got %s", test.path, test.uri, uri)
+		}
+	}
+}
+
+func TestCanonicalQueryString(t *testing.T) {
+	tests := []struct {
+		query     string
+		canonical string
+	}{
+		{query: "", canonical: ""},
+		{query: "name=pvc-1", canonical: "name=pvc-1"},
+		{query: "limit=2&marker=m", canonical: "limit=2&marker=m"},
+		{query: "marker=m&limit=2", canonical: "limit=2&marker=m"},
+		{query: "a=2&b=1&a=1", canonical: "a=1&a=2&b=1"},
+		{query: "name=a%20b&sort=a%2Bb", canonical: "name=a%20b&sort=a%2Bb"},
+		{query: "name=a+b", canonical: "name=a%20b"},
+		{query: "tag=k%3Dv&x%2Fy=1", canonical: "tag=k%3Dv&x%2Fy=1"},
+		{query: "is_public", canonical: "is_public="},
+	}
+
+	for _, test := range tests {
+		r := &http.Request{URL: mustParseURL(t, "https://sfs.region.example.com/v2/shares?"+test.query)}
+		if canonical := canonicalQueryString(r); canonical != test.canonical {
+			t.Errorf("%q: expected %s, got %s", test.query, test.canonical, canonical)
+		}
+	}
+}
+
+func TestCanonicalHeaders(t *testing.T) {
+	r := newSignRequest(t, "GET", "https://sfs.region.example.com/v2/shares")
+	r.Header.Add("X-Multi", " b ")
+	r.Header.Add("X-Multi", "a")
+	r.Header.Set("User-Agent", "golangsdk")
+
+	names := signedHeaderNames(r)
+	if joined := strings.Join(names, ";"); joined != "content-type;host;x-multi" {
+		t.Errorf("Unexpected signed headers %s", joined)
+	}
+	expected := "content-type:application/json\nhost:sfs.region.example.com\nx-multi:a\nx-multi:b\n"
+	if headers := canonicalHeaders(r, names); headers != expected {
+		t.Errorf("Expected canonical headers\n%s\ngot\n%s", expected, headers)
+	}
+}
+
+func TestSignEscape(t *testing.T) {
+	tests := map[string]string{
+		"abcXYZ019-_.~": "abcXYZ019-_.~",
+		"a b":           "a%20b",
+		"a+b=c&d/e":     "a%2Bb%3Dc%26d%2Fe",
+		"é":             "%C3%A9",
+	}
+
+	for s, escaped := range tests {
+		if e := signEscape(s); e != escaped {
+			t.Errorf("%q: expected %s, got %s", s, escaped, e)
+		}
+	}
+}
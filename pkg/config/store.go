@@ -0,0 +1,150 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CloudConfigSecretKey is the key of the cloud config in a secret
+const CloudConfigSecretKey = "cloud.conf"
+
+// Store holds the current cloud credentials, which are replaced when the config is rotated.
+// Operations get the credentials once, so that in-flight operations finish on the old clients.
+type Store struct {
+	mu   sync.RWMutex
+	cc   *CloudCredentials
+	data []byte
+}
+
+// NewStore creates a store of the given credentials
+func NewStore(cc *CloudCredentials) *Store {
+	return &Store{cc: cc}
+}
+
+// NewStoreFromFile creates a store of the credentials loaded from file
+func NewStoreFromFile(configFile string) (*Store, error) {
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("load config from file: %s", configFile)
+	return newStoreFromBytes(data)
+}
+
+// NewStoreFromSecret creates a store of the credentials loaded from secret
+func NewStoreFromSecret(c clientset.Interface, namespace, name string) (*Store, error) {
+	secret, err := c.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data, ok := secret.Data[CloudConfigSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("Secret %s/%s has no key %s", namespace, name, CloudConfigSecretKey)
+	}
+	glog.Infof("load config from secret: %s/%s", namespace, name)
+	return newStoreFromBytes(data)
+}
+
+// newStoreFromBytes creates a store of the credentials loaded from data
+func newStoreFromBytes(data []byte) (*Store, error) {
+	cc, err := LoadConfigFromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{cc: &cc, data: data}, nil
+}
+
+// Get the current credentials
+func (s *Store) Get() *CloudCredentials {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cc
+}
+
+// update rebuilds the credentials if data changed, the current ones are kept on errors
+func (s *Store) update(data []byte) {
+	s.mu.RLock()
+	changed := !bytes.Equal(s.data, data)
+	s.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	glog.Info("Cloud config changed, rebuild cloud clients...")
+	cc, err := LoadConfigFromBytes(data)
+	if err != nil {
+		glog.Errorf("Failed to load changed cloud config, keep the current one: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	s.cc = &cc
+	s.data = data
+	s.mu.Unlock()
+	glog.Info("Cloud clients rebuilt")
+}
+
+// WatchFile reloads the credentials when the file changes until stopCh is closed
+func (s *Store) WatchFile(configFile string, period time.Duration, stopCh <-chan struct{}) {
+	wait.Until(func() {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			glog.Errorf("Failed to read cloud config %s: %v", configFile, err)
+			return
+		}
+		s.update(data)
+	}, period, stopCh)
+}
+
+// WatchSecret reloads the credentials when the secret changes until stopCh is closed
+func (s *Store) WatchSecret(c clientset.Interface, namespace, name string, stopCh <-chan struct{}) {
+	updateFromSecret := func(obj interface{}) {
+		secret, ok := obj.(*v1.Secret)
+		if !ok {
+			return
+		}
+		data, ok := secret.Data[CloudConfigSecretKey]
+		if !ok {
+			glog.Errorf("Secret %s/%s has no key %s", namespace, name, CloudConfigSecretKey)
+			return
+		}
+		s.update(data)
+	}
+
+	source := cache.NewListWatchFromClient(c.CoreV1().RESTClient(), "secrets", namespace,
+		fields.OneTermEqualSelector("metadata.name", name))
+	_, controller := cache.NewInformer(source, &v1.Secret{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: updateFromSecret,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			updateFromSecret(newObj)
+		},
+	})
+	controller.Run(stopCh)
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/glog"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+	"github.com/huaweicloud/golangsdk"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// cloneSnapshotName returns the name of the intermediate snapshot of a cloned volume
+func cloneSnapshotName(volName string) string {
+	return "clone-" + volName
+}
+
+// prepareContentSource validates the content source of the request and returns the
+// snapshot to create the share from. Cloning a volume creates an intermediate snapshot.
+func (cs *ControllerServer) prepareContentSource(ctx context.Context, client *golangsdk.ServiceClient, req *csi.CreateVolumeRequest, size int64, proto string) (string, error) {
+	source := req.GetVolumeContentSource()
+	if source == nil {
+		return "", nil
+	}
+
+	// create from snapshot
+	if src := source.GetSnapshot(); src != nil {
+		snapshot, err := sfs.GetSnapshot(client, src.GetSnapshotId())
+		if err != nil {
+			if _, ok := err.(golangsdk.ErrDefault404); ok {
+				return "", status.Errorf(codes.NotFound, "Snapshot %s not found", src.GetSnapshotId())
+			}
+			return "", status.Errorf(codes.Internal, "Failed to get snapshot: %v", err)
+		}
+		if snapshot.Status != sfs.SFSStatusAvailable {
+			return "", status.Errorf(codes.Unavailable, "Snapshot %s is in status %s", snapshot.ID, snapshot.Status)
+		}
+		if err := validateSource("snapshot "+snapshot.ID, snapshot.ShareSize, snapshot.ShareProto, size, proto); err != nil {
+			return "", err
+		}
+		return snapshot.ID, nil
+	}
+
+	// clone volume
+	src := source.GetVolume()
+	if src == nil {
+		return "", status.Error(codes.InvalidArgument, "Unsupported volume content source")
+	}
+	share, err := sfs.GetShare(client, src.GetVolumeId())
+	if err != nil {
+		if _, ok := err.(golangsdk.ErrDefault404); ok {
+			return "", status.Errorf(codes.NotFound, "Share %s not found", src.GetVolumeId())
+		}
+		return "", status.Errorf(codes.Internal, "Failed to get share: %v", err)
+	}
+	if err := validateSource("share "+share.ID, share.Size, share.ShareProto, size, proto); err != nil {
+		return "", err
+	}
+
+	// reuse the intermediate snapshot of a previous call
+	name := cloneSnapshotName(req.GetName())
+	snapshot, err := sfs.FindSnapshotByName(client, name)
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "Failed to find snapshot: %v", err)
+	}
+	if snapshot == nil {
+		snapshot, err = sfs.CreateSnapshot(client, share.ID, name, fmt.Sprintf("Source of volume %s", req.GetName()))
+		if err != nil {
+			return "", status.Errorf(codes.Internal, "Failed to create snapshot: %v", err)
+		}
+	}
+	err = sfs.WaitForSnapshotStatus(ctx, client, snapshot.ID, sfs.SFSStatusAvailable, cs.driver.backoff)
+	if err != nil {
+		return "", status.Errorf(shareErrorCode(ctx), "Waiting for snapshot %s to become created failed: %v", snapshot.ID, err)
+	}
+	return snapshot.ID, nil
+}
+
+// cleanupContentSource deletes the intermediate snapshot of a cloned volume
+func (cs *ControllerServer) cleanupContentSource(ctx context.Context, client *golangsdk.ServiceClient, req *csi.CreateVolumeRequest) error {
+	if req.GetVolumeContentSource().GetVolume() == nil {
+		return nil
+	}
+
+	snapshot, err := sfs.FindSnapshotByName(client, cloneSnapshotName(req.GetName()))
+	if err != nil {
+		return status.Errorf(codes.Internal, "Failed to find snapshot: %v", err)
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	glog.Infof("Delete intermediate snapshot %s of volume %s", snapshot.ID, req.GetName())
+	err = sfs.DeleteSnapshotAndWait(ctx, client, snapshot.ID, cs.driver.backoff)
+	if err != nil {
+		return status.Errorf(shareErrorCode(ctx), "Failed to delete snapshot %s: %v", snapshot.ID, err)
+	}
+	return nil
+}
+
+// validateSource checks a share of the requested size and protocol can be created from the source
+func validateSource(source string, sourceSize int, sourceProto string, size int64, proto string) error {
+	if int64(sourceSize)*gigabyte > size {
+		return status.Errorf(codes.OutOfRange, "Requested size %dGB is smaller than the size %dGB of %s",
+			size/gigabyte, sourceSize, source)
+	}
+	if sourceProto != "" && !strings.EqualFold(sourceProto, proto) {
+		return status.Errorf(codes.InvalidArgument, "Requested protocol %s differs from the protocol %s of %s",
+			proto, sourceProto, source)
+	}
+	return nil
+}
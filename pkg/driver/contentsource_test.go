@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"golang.org/x/net/context"
+)
+
+// newCloneRequest returns a request cloning the volume of the share
+func newCloneRequest(name string, shareID string) *csi.CreateVolumeRequest {
+	req := newCreateRequest(name, nil)
+	req.VolumeContentSource = &csi.VolumeContentSource{
+		Type: &csi.VolumeContentSource_Volume{
+			Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: shareID},
+		},
+	}
+	return req
+}
+
+func TestCreateVolumeClone(t *testing.T) {
+	tests := []struct {
+		name         string
+		createStatus string
+		created      bool
+	}{
+		{name: "cloned", created: true},
+		{name: "clone in error status", createStatus: sfs.SFSStatusError, created: false},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		cloud.CreateStatus = test.createStatus
+		cloud.AddShare(&fake.Share{Share: shares.Share{
+			ID:             "source",
+			ShareProto:     "NFS",
+			Size:           10,
+			Status:         sfs.SFSStatusAvailable,
+			ExportLocation: "192.168.0.10:/source",
+		}})
+		cs := newTestController(cloud, 10)
+
+		_, err := cs.CreateVolume(context.Background(), newCloneRequest("pvc-1", "source"))
+		if created := err == nil; created != test.created {
+			t.Errorf("%s: expected created %v, got %v", test.name, test.created, err)
+		}
+		if calls := cloud.Calls("snapshot_create"); calls != 1 {
+			t.Errorf("%s: expected one intermediate snapshot, got %d", test.name, calls)
+		}
+		if ids := cloud.Snapshots(); len(ids) != 0 {
+			t.Errorf("%s: expected the intermediate snapshot to be deleted, got %v", test.name, ids)
+		}
+		if ids := cloud.Shares(); !test.created && len(ids) != 1 {
+			t.Errorf("%s: expected the clone to be deleted, got %v", test.name, ids)
+		}
+		for _, id := range cloud.Shares() {
+			if share := cloud.GetShare(id); id != "source" && share.SnapshotID == "" {
+				t.Errorf("%s: expected clone %s to be created from the intermediate snapshot", test.name, id)
+			}
+		}
+		cloud.Close()
+	}
+}
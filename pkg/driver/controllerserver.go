@@ -0,0 +1,525 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ControllerServer implements csi.ControllerServer
+type ControllerServer struct {
+	driver *Driver
+}
+
+// NewControllerServer creates a new controller server of the driver
+func NewControllerServer(d *Driver) *ControllerServer {
+	return &ControllerServer{driver: d}
+}
+
+// CreateVolume creates a share and grants access to the cluster
+func (cs *ControllerServer) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
+	// check arguments
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume name must be provided")
+	}
+	if len(req.GetVolumeCapabilities()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume capabilities must be provided")
+	}
+	if err := cs.driver.validateVolumeCapabilities(req.GetVolumeCapabilities()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	size := requestedSize(req.GetCapacityRange())
+
+	// validate the parameters before creating the share
+	volOptions := buildVolumeOptions(req, size)
+	if err := validateProtocol(volOptions.Parameters); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := sfs.ValidateLocationParameters(volOptions.Parameters); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	rules, err := sfs.ParseAccessRules(volOptions.Parameters)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := sfs.IsReadOnly(volOptions); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := sfs.VPCAccess(volOptions, cs.driver.vpcids); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	zone, err := selectZone(volOptions.Parameters, req.GetAccessibilityRequirements())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if zone != "" {
+		parameters := map[string]string{}
+		for k, v := range volOptions.Parameters {
+			parameters[k] = v
+		}
+		parameters[sfs.SFSParametersAvailability] = zone
+		volOptions.Parameters = parameters
+	}
+
+	// init sfs client
+	client, err := cs.driver.cloudconfig.SFSV2Client()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create SFS v2 client: %v", err)
+	}
+
+	waitCtx, cancel := cs.driver.shareContext(ctx)
+	defer cancel()
+
+	// reuse the share of a previous call
+	share, err := sfs.FindShareByName(client, sfs.GetShareName(volOptions.PVC))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to find share: %v", err)
+	}
+	created := false
+	if share != nil {
+		if int64(share.Size)*gigabyte < size {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"Share %s already exists with size %dGB", share.ID, share.Size)
+		}
+		glog.Infof("Share %s of volume %s already exists", share.ID, req.GetName())
+	} else {
+		snapshotID, err := cs.prepareContentSource(waitCtx, client, req, size, sfs.SFSParametersProtocolDefault)
+		if err != nil {
+			return nil, err
+		}
+
+		glog.Infof("Create share for volume: %s", req.GetName())
+		share, err = sfs.CreateShare(client, volOptions, snapshotID, cs.driver.clusterID)
+		if err != nil {
+			if cleanupErr := cs.cleanupContentSource(waitCtx, client, req); cleanupErr != nil {
+				glog.Errorf("Failed to clean up content source of volume %s: %v", req.GetName(), cleanupErr)
+			}
+			return nil, status.Errorf(codes.Internal, "Failed to create share: %v", err)
+		}
+		created = true
+	}
+
+	volume, failed, err := cs.publishShare(waitCtx, client, req, share, volOptions, rules)
+	if err != nil {
+		// a share whose wait timed out is resumed by the next call
+		if waitCtx.Err() == nil && (created || failed) {
+			cs.rollbackShare(client, req, share.ID)
+		}
+		return nil, err
+	}
+
+	return &csi.CreateVolumeResponse{Volume: volume}, nil
+}
+
+// publishShare waits for the share to become available, grants access to it and returns the volume,
+// failed reports whether the share is in a failure status
+func (cs *ControllerServer) publishShare(waitCtx context.Context, client *golangsdk.ServiceClient, req *csi.CreateVolumeRequest, share *shares.Share, volOptions *controller.VolumeOptions, rules []backends.Access) (*csi.Volume, bool, error) {
+	// wait for share available
+	err := sfs.WaitForShareStatus(waitCtx, client, share.ID, sfs.SFSStatusAvailable, cs.driver.backoff)
+	if err != nil {
+		return nil, sfs.IsShareFailed(err), status.Errorf(shareErrorCode(waitCtx), "Waiting for share %s to become created failed: %v", share.ID, err)
+	}
+	share, err = sfs.GetShare(client, share.ID)
+	if err != nil {
+		return nil, false, status.Errorf(codes.Internal, "Failed to get share: %v", err)
+	}
+
+	// the intermediate snapshot of a clone is not needed anymore
+	err = cs.cleanupContentSource(waitCtx, client, req)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// grant access
+	rights, err := sfs.GrantAccess(client, volOptions, share.ID, cs.driver.vpcids)
+	if err != nil {
+		return nil, false, status.Errorf(codes.Internal, "Failed to grant access: %v", err)
+	}
+	var accessIDs []string
+	for _, right := range rights {
+		accessIDs = append(accessIDs, right.ID)
+	}
+	for _, r := range rules {
+		access, err := sfs.GrantAccessRule(client, share.ID, r)
+		if err != nil {
+			return nil, false, status.Errorf(codes.Internal, "Failed to grant %s access to %s: %v", r.AccessType, r.AccessTo, err)
+		}
+		accessIDs = append(accessIDs, access.ID)
+	}
+	err = sfs.WaitForAccessActive(waitCtx, client, share.ID, accessIDs, cs.driver.backoff)
+	if err != nil {
+		return nil, false, status.Errorf(shareErrorCode(waitCtx), "Waiting for access rules of share %s to become active failed: %v", share.ID, err)
+	}
+
+	// build volume context
+	volCtx, err := buildVolumeContext(client, share, volOptions)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, false, err
+		}
+		return nil, false, status.Error(codes.Internal, err.Error())
+	}
+
+	volume := &csi.Volume{
+		VolumeId:      share.ID,
+		CapacityBytes: int64(share.Size) * gigabyte,
+		VolumeContext: volCtx,
+		ContentSource: req.GetVolumeContentSource(),
+	}
+	if share.AvailabilityZone != "" {
+		volume.AccessibleTopology = zoneTopology(share.AvailabilityZone)
+	}
+	return volume, false, nil
+}
+
+// rollbackShare deletes the share and the intermediate snapshot of a failed call
+func (cs *ControllerServer) rollbackShare(client *golangsdk.ServiceClient, req *csi.CreateVolumeRequest, shareID string) {
+	glog.Infof("Rollback: delete share %s of failed volume", shareID)
+	ctx, cancel := cs.driver.shareContext(context.Background())
+	defer cancel()
+	if err := sfs.DeleteShareAndWait(ctx, client, shareID, cs.driver.backoff); err != nil {
+		glog.Errorf("Failed to delete share %s of failed volume: %v", shareID, err)
+	}
+	if err := cs.cleanupContentSource(ctx, client, req); err != nil {
+		glog.Errorf("Failed to clean up content source of volume %s: %v", req.GetName(), err)
+	}
+}
+
+// DeleteVolume deletes the share of the volume
+func (cs *ControllerServer) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID must be provided")
+	}
+
+	client, err := cs.driver.cloudconfig.SFSV2Client()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create SFS v2 client: %v", err)
+	}
+
+	glog.Infof("Delete share: %s", req.GetVolumeId())
+	waitCtx, cancel := cs.driver.shareContext(ctx)
+	defer cancel()
+	err = sfs.DeleteShareAndWait(waitCtx, client, req.GetVolumeId(), cs.driver.backoff)
+	if err != nil {
+		return nil, status.Errorf(shareErrorCode(waitCtx), "Failed to delete share: %v", err)
+	}
+
+	return &csi.DeleteVolumeResponse{}, nil
+}
+
+// ControllerExpandVolume expands the share of the volume
+func (cs *ControllerServer) ControllerExpandVolume(ctx context.Context, req *csi.ControllerExpandVolumeRequest) (*csi.ControllerExpandVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID must be provided")
+	}
+	if req.GetCapacityRange() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Capacity range must be provided")
+	}
+	size := int(requestedSize(req.GetCapacityRange()) / gigabyte)
+
+	client, err := cs.driver.cloudconfig.SFSV2Client()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create SFS v2 client: %v", err)
+	}
+
+	share, err := sfs.GetShare(client, req.GetVolumeId())
+	if err != nil {
+		if _, ok := err.(golangsdk.ErrDefault404); ok {
+			return nil, status.Errorf(codes.NotFound, "Share %s not found", req.GetVolumeId())
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to get share: %v", err)
+	}
+
+	if share.Size < size {
+		glog.Infof("Expand share %s from %dGB to %dGB", share.ID, share.Size, size)
+		err = sfs.ExpandShare(client, share.ID, size)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to expand share: %v", err)
+		}
+		waitCtx, cancel := cs.driver.shareContext(ctx)
+		defer cancel()
+		err = sfs.WaitForShareStatus(waitCtx, client, share.ID, sfs.SFSStatusAvailable, cs.driver.backoff)
+		if err != nil {
+			return nil, status.Errorf(shareErrorCode(waitCtx), "Waiting for share %s to be expanded failed: %v", share.ID, err)
+		}
+		share, err = sfs.GetShare(client, share.ID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to get share: %v", err)
+		}
+		if share.Size < size {
+			return nil, status.Errorf(codes.Internal, "Share %s is available with %dGB instead of %dGB", share.ID, share.Size, size)
+		}
+	} else {
+		size = share.Size
+	}
+
+	return &csi.ControllerExpandVolumeResponse{
+		CapacityBytes:         int64(size) * gigabyte,
+		NodeExpansionRequired: false,
+	}, nil
+}
+
+// ValidateVolumeCapabilities checks the capabilities are supported by the share
+func (cs *ControllerServer) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID must be provided")
+	}
+	if len(req.GetVolumeCapabilities()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume capabilities must be provided")
+	}
+
+	client, err := cs.driver.cloudconfig.SFSV2Client()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create SFS v2 client: %v", err)
+	}
+
+	_, err = sfs.GetShare(client, req.GetVolumeId())
+	if err != nil {
+		if _, ok := err.(golangsdk.ErrDefault404); ok {
+			return nil, status.Errorf(codes.NotFound, "Share %s not found", req.GetVolumeId())
+		}
+		return nil, status.Errorf(codes.Internal, "Failed to get share: %v", err)
+	}
+
+	if err := cs.driver.validateVolumeCapabilities(req.GetVolumeCapabilities()); err != nil {
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+	}
+
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.GetVolumeContext(),
+			VolumeCapabilities: req.GetVolumeCapabilities(),
+			Parameters:         req.GetParameters(),
+		},
+	}, nil
+}
+
+// ControllerGetCapabilities returns the capabilities of the controller service
+func (cs *ControllerServer) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
+	return &csi.ControllerGetCapabilitiesResponse{
+		Capabilities: cs.driver.cscap,
+	}, nil
+}
+
+// ControllerPublishVolume is not supported, shares are attached by mounting
+func (cs *ControllerServer) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// ControllerUnpublishVolume is not supported, shares are detached by unmounting
+func (cs *ControllerServer) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// ListVolumes is not supported
+func (cs *ControllerServer) ListVolumes(ctx context.Context, req *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// GetCapacity is not supported
+func (cs *ControllerServer) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// CreateSnapshot creates a snapshot of the share of the volume
+func (cs *ControllerServer) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot name must be provided")
+	}
+	if req.GetSourceVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Source volume ID must be provided")
+	}
+
+	client, err := cs.driver.cloudconfig.SFSV2Client()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create SFS v2 client: %v", err)
+	}
+
+	// reuse the snapshot of a previous call
+	snapshot, err := sfs.FindSnapshotByName(client, req.GetName())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to find snapshot: %v", err)
+	}
+	if snapshot != nil {
+		if snapshot.ShareID != req.GetSourceVolumeId() {
+			return nil, status.Errorf(codes.AlreadyExists,
+				"Snapshot %s already exists for share %s", req.GetName(), snapshot.ShareID)
+		}
+		glog.Infof("Snapshot %s of share %s already exists", snapshot.ID, snapshot.ShareID)
+	} else {
+		_, err = sfs.GetShare(client, req.GetSourceVolumeId())
+		if err != nil {
+			if _, ok := err.(golangsdk.ErrDefault404); ok {
+				return nil, status.Errorf(codes.NotFound, "Share %s not found", req.GetSourceVolumeId())
+			}
+			return nil, status.Errorf(codes.Internal, "Failed to get share: %v", err)
+		}
+		snapshot, err = sfs.CreateSnapshot(client, req.GetSourceVolumeId(), req.GetName(),
+			fmt.Sprintf("Created by %s", cs.driver.name))
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to create snapshot: %v", err)
+		}
+	}
+
+	// the sidecar calls again until the snapshot is ready to use
+	if snapshot.Status == sfs.SFSStatusError {
+		return nil, status.Errorf(codes.Internal, "Snapshot %s is in status %s", snapshot.ID, snapshot.Status)
+	}
+	csiSnapshot, err := buildSnapshot(snapshot)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.CreateSnapshotResponse{Snapshot: csiSnapshot}, nil
+}
+
+// DeleteSnapshot deletes the share snapshot
+func (cs *ControllerServer) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
+	if req.GetSnapshotId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID must be provided")
+	}
+
+	client, err := cs.driver.cloudconfig.SFSV2Client()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create SFS v2 client: %v", err)
+	}
+
+	glog.Infof("Delete snapshot: %s", req.GetSnapshotId())
+	waitCtx, cancel := cs.driver.shareContext(ctx)
+	defer cancel()
+	err = sfs.DeleteSnapshotAndWait(waitCtx, client, req.GetSnapshotId(), cs.driver.backoff)
+	if err != nil {
+		return nil, status.Errorf(shareErrorCode(waitCtx), "Failed to delete snapshot: %v", err)
+	}
+
+	return &csi.DeleteSnapshotResponse{}, nil
+}
+
+// ListSnapshots lists the share snapshots, optionally of a snapshot or volume
+func (cs *ControllerServer) ListSnapshots(ctx context.Context, req *csi.ListSnapshotsRequest) (*csi.ListSnapshotsResponse, error) {
+	client, err := cs.driver.cloudconfig.SFSV2Client()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to create SFS v2 client: %v", err)
+	}
+
+	var snapshots []sfs.ShareSnapshot
+	if req.GetSnapshotId() != "" {
+		snapshot, err := sfs.GetSnapshot(client, req.GetSnapshotId())
+		if err != nil {
+			if _, ok := err.(golangsdk.ErrDefault404); ok {
+				return &csi.ListSnapshotsResponse{}, nil
+			}
+			return nil, status.Errorf(codes.Internal, "Failed to get snapshot: %v", err)
+		}
+		if req.GetSourceVolumeId() == "" || req.GetSourceVolumeId() == snapshot.ShareID {
+			snapshots = append(snapshots, *snapshot)
+		}
+	} else {
+		snapshots, err = sfs.ListSnapshots(client, sfs.SnapshotListOpts{ShareID: req.GetSourceVolumeId()})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "Failed to list snapshots: %v", err)
+		}
+	}
+
+	// page through the snapshots, the token is the offset of the next entry
+	start := 0
+	if req.GetStartingToken() != "" {
+		start, err = strconv.Atoi(req.GetStartingToken())
+		if err != nil || start < 0 || start > len(snapshots) {
+			return nil, status.Errorf(codes.Aborted, "Invalid starting token %s", req.GetStartingToken())
+		}
+	}
+	end := len(snapshots)
+	if req.GetMaxEntries() > 0 && start+int(req.GetMaxEntries()) < end {
+		end = start + int(req.GetMaxEntries())
+	}
+
+	resp := &csi.ListSnapshotsResponse{}
+	for i := range snapshots[start:end] {
+		csiSnapshot, err := buildSnapshot(&snapshots[start+i])
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		resp.Entries = append(resp.Entries, &csi.ListSnapshotsResponse_Entry{Snapshot: csiSnapshot})
+	}
+	if end < len(snapshots) {
+		resp.NextToken = strconv.Itoa(end)
+	}
+
+	return resp, nil
+}
+
+// buildSnapshot converts a share snapshot into a csi snapshot
+func buildSnapshot(snapshot *sfs.ShareSnapshot) (*csi.Snapshot, error) {
+	creationTime, err := ptypes.TimestampProto(time.Time(snapshot.CreatedAt))
+	if err != nil {
+		return nil, err
+	}
+
+	return &csi.Snapshot{
+		SnapshotId:     snapshot.ID,
+		SourceVolumeId: snapshot.ShareID,
+		SizeBytes:      int64(snapshot.Size) * gigabyte,
+		CreationTime:   creationTime,
+		ReadyToUse:     snapshot.Status == sfs.SFSStatusAvailable,
+	}, nil
+}
+
+// buildVolumeContext returns the attributes needed by the node service to mount the share
+func buildVolumeContext(client *golangsdk.ServiceClient, share *shares.Share, volOptions *controller.VolumeOptions) (map[string]string, error) {
+	location, err := sfs.SelectShareLocation(client, share, volOptions.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := sfs.GetBackend(share.ShareProto)
+	if err != nil {
+		return nil, err
+	}
+
+	readOnly, err := sfs.IsReadOnly(volOptions)
+	if err != nil {
+		return nil, err
+	}
+	pvsource, err := b.BuildSource(&backends.BuildSourceArgs{Location: location, ReadOnly: readOnly})
+	if err != nil {
+		return nil, err
+	}
+	if pvsource.NFS == nil {
+		return nil, status.Errorf(codes.Unimplemented, "Share protocol %s is not supported", share.ShareProto)
+	}
+
+	return map[string]string{
+		volumeContextServer:   pvsource.NFS.Server,
+		volumeContextPath:     pvsource.NFS.Path,
+		volumeContextReadOnly: strconv.FormatBool(pvsource.NFS.ReadOnly),
+	}, nil
+}
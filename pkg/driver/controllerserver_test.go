@@ -0,0 +1,272 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestController returns a controller server of a driver using the fake cloud
+func newTestController(cloud *fake.Cloud, timeout int) *ControllerServer {
+	d := NewDriver(DriverName, "node", "unix:///tmp/csi.sock", cloud.Credentials(), timeout, "vpc-1",
+		ShareBackoff(sfs.Backoff{Duration: time.Millisecond, Factor: 1}))
+	return NewControllerServer(d)
+}
+
+func newCreateRequest(name string, parameters map[string]string) *csi.CreateVolumeRequest {
+	return &csi.CreateVolumeRequest{
+		Name: name,
+		CapacityRange: &csi.CapacityRange{
+			RequiredBytes: 10 * gigabyte,
+		},
+		VolumeCapabilities: []*csi.VolumeCapability{
+			{
+				AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+				AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER},
+			},
+		},
+		Parameters: parameters,
+	}
+}
+
+func TestCreateVolume(t *testing.T) {
+	cloud := fake.NewCloud()
+	defer cloud.Close()
+	cs := newTestController(cloud, 10)
+
+	req := newCreateRequest("pvc-1", nil)
+	resp, err := cs.CreateVolume(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CreateVolume failed: %v", err)
+	}
+	volume := resp.GetVolume()
+	if volume.GetCapacityBytes() != 10*gigabyte {
+		t.Errorf("Expected capacity of 10GB, got %d", volume.GetCapacityBytes())
+	}
+	if volume.GetVolumeContext()[volumeContextServer] != "192.168.0.10" {
+		t.Errorf("Unexpected volume context %v", volume.GetVolumeContext())
+	}
+	share := cloud.GetShare(volume.GetVolumeId())
+	if share == nil || len(share.Access) != 1 || share.Access[0].AccessTo != "vpc-1" {
+		t.Fatalf("Expected the share to grant access to vpc-1, got %+v", share)
+	}
+
+	// a repeated call returns the same volume
+	again, err := cs.CreateVolume(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Repeated CreateVolume failed: %v", err)
+	}
+	if again.GetVolume().GetVolumeId() != volume.GetVolumeId() {
+		t.Errorf("Expected volume %s, got %s", volume.GetVolumeId(), again.GetVolume().GetVolumeId())
+	}
+	if calls := cloud.Calls("create"); calls != 1 {
+		t.Errorf("Expected one share to be created, got %d", calls)
+	}
+	if calls := cloud.Calls("os-allow_access"); calls != 1 {
+		t.Errorf("Expected access to be granted once, got %d", calls)
+	}
+}
+
+func TestCreateVolumeInvalidParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		topology   *csi.TopologyRequirement
+	}{
+		{
+			name:       "cifs protocol",
+			parameters: map[string]string{sfs.SFSParametersProtocol: "CIFS"},
+		},
+		{
+			name:       "availability outside of the requisite zones",
+			parameters: map[string]string{sfs.SFSParametersAvailability: "az-2"},
+			topology:   &csi.TopologyRequirement{Requisite: zoneTopology("az-1")},
+		},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		cs := newTestController(cloud, 10)
+
+		req := newCreateRequest("pvc-1", test.parameters)
+		req.AccessibilityRequirements = test.topology
+		_, err := cs.CreateVolume(context.Background(), req)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected InvalidArgument, got %v", test.name, err)
+		}
+		if calls := cloud.Calls("create"); calls != 0 {
+			t.Errorf("%s: expected no share to be created, got %d", test.name, calls)
+		}
+		cloud.Close()
+	}
+}
+
+func TestCreateVolumeTopology(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		topology   *csi.TopologyRequirement
+		zone       string
+	}{
+		{
+			name: "no requirements",
+		},
+		{
+			name:       "availability parameter",
+			parameters: map[string]string{sfs.SFSParametersAvailability: "az-2"},
+			topology:   &csi.TopologyRequirement{Requisite: append(zoneTopology("az-1"), zoneTopology("az-2")...)},
+			zone:       "az-2",
+		},
+		{
+			name: "preferred zone",
+			topology: &csi.TopologyRequirement{
+				Requisite: append(zoneTopology("az-1"), zoneTopology("az-2")...),
+				Preferred: zoneTopology("az-2"),
+			},
+			zone: "az-2",
+		},
+		{
+			name:     "requisite zone",
+			topology: &csi.TopologyRequirement{Requisite: zoneTopology("az-1")},
+			zone:     "az-1",
+		},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		cs := newTestController(cloud, 10)
+
+		req := newCreateRequest("pvc-1", test.parameters)
+		req.AccessibilityRequirements = test.topology
+		resp, err := cs.CreateVolume(context.Background(), req)
+		if err != nil {
+			t.Errorf("%s: CreateVolume failed: %v", test.name, err)
+			cloud.Close()
+			continue
+		}
+		zones := topologyZones(resp.GetVolume().GetAccessibleTopology())
+		if test.zone == "" && len(zones) != 0 {
+			t.Errorf("%s: expected no topology, got %v", test.name, zones)
+		}
+		if test.zone != "" && (len(zones) != 1 || zones[0] != test.zone) {
+			t.Errorf("%s: expected topology of zone %s, got %v", test.name, test.zone, zones)
+		}
+		if share := cloud.GetShare(resp.GetVolume().GetVolumeId()); share.AvailabilityZone != test.zone {
+			t.Errorf("%s: expected share in zone %q, got %q", test.name, test.zone, share.AvailabilityZone)
+		}
+		cloud.Close()
+	}
+}
+
+func TestCreateVolumeRollback(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(*fake.Cloud)
+		code  codes.Code
+	}{
+		{
+			name:  "grant failure",
+			setup: func(c *fake.Cloud) { c.GrantError = http.StatusInternalServerError },
+			code:  codes.Internal,
+		},
+		{
+			name:  "share in error status",
+			setup: func(c *fake.Cloud) { c.CreateStatus = sfs.SFSStatusError },
+			code:  codes.Internal,
+		},
+		{
+			name:  "access rule in error state",
+			setup: func(c *fake.Cloud) { c.AccessState = sfs.SFSAccessStateError },
+			code:  codes.Internal,
+		},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		test.setup(cloud)
+		cs := newTestController(cloud, 10)
+
+		_, err := cs.CreateVolume(context.Background(), newCreateRequest("pvc-1", nil))
+		if status.Code(err) != test.code {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, err)
+		}
+		if ids := cloud.Shares(); len(ids) != 0 {
+			t.Errorf("%s: expected the share to be deleted, got %v", test.name, ids)
+		}
+		cloud.Close()
+	}
+}
+
+func TestCreateVolumeTimeout(t *testing.T) {
+	cloud := fake.NewCloud()
+	defer cloud.Close()
+	cloud.CreateStatus = "creating"
+	cs := newTestController(cloud, 1)
+
+	_, err := cs.CreateVolume(context.Background(), newCreateRequest("pvc-1", nil))
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	// the share is resumed by the next call
+	ids := cloud.Shares()
+	if len(ids) != 1 {
+		t.Fatalf("Expected the share to be kept, got %v", ids)
+	}
+
+	share := cloud.GetShare(ids[0])
+	share.Status = sfs.SFSStatusAvailable
+	cloud.AddShare(share)
+	resp, err := cs.CreateVolume(context.Background(), newCreateRequest("pvc-1", nil))
+	if err != nil {
+		t.Fatalf("Resumed CreateVolume failed: %v", err)
+	}
+	if resp.GetVolume().GetVolumeId() != share.ID {
+		t.Errorf("Expected volume %s, got %s", share.ID, resp.GetVolume().GetVolumeId())
+	}
+}
+
+func TestDeleteVolume(t *testing.T) {
+	cloud := fake.NewCloud()
+	defer cloud.Close()
+	cs := newTestController(cloud, 10)
+
+	resp, err := cs.CreateVolume(context.Background(), newCreateRequest("pvc-1", nil))
+	if err != nil {
+		t.Fatalf("CreateVolume failed: %v", err)
+	}
+	req := &csi.DeleteVolumeRequest{VolumeId: resp.GetVolume().GetVolumeId()}
+	if _, err := cs.DeleteVolume(context.Background(), req); err != nil {
+		t.Fatalf("DeleteVolume failed: %v", err)
+	}
+	if ids := cloud.Shares(); len(ids) != 0 {
+		t.Errorf("Expected the share to be deleted, got %v", ids)
+	}
+
+	// deleting a missing volume succeeds
+	if _, err := cs.DeleteVolume(context.Background(), req); err != nil {
+		t.Errorf("Repeated DeleteVolume failed: %v", err)
+	}
+}
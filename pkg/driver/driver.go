@@ -0,0 +1,159 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/glog"
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+	"k8s.io/kubernetes/pkg/util/mount"
+)
+
+// Defines driver constants
+const (
+	DriverName    = "sfs.csi.huaweicloud.com"
+	DriverVersion = "1.0.0"
+)
+
+// Driver implements the csi identity, controller and node services
+type Driver struct {
+	name         string
+	nodeID       string
+	endpoint     string
+	cloudconfig  *config.CloudCredentials
+	sharetimeout int
+	vpcids       []string
+	backoff      sfs.Backoff
+	clusterID    string
+	zone         string
+	mounter      mount.Interface
+
+	cscap []*csi.ControllerServiceCapability
+	vcap  []*csi.VolumeCapability_AccessMode
+}
+
+// ShareBackoff sets the intervals of polling share status
+func ShareBackoff(backoff sfs.Backoff) func(*Driver) {
+	return func(d *Driver) {
+		d.backoff = backoff
+	}
+}
+
+// ClusterID tags the shares with the id of the cluster
+func ClusterID(clusterID string) func(*Driver) {
+	return func(d *Driver) {
+		d.clusterID = clusterID
+	}
+}
+
+// Zone sets the availability zone of the node reported as its topology
+func Zone(zone string) func(*Driver) {
+	return func(d *Driver) {
+		d.zone = zone
+	}
+}
+
+// NewDriver creates a new instance of sfs csi driver.
+// The cloud config may be nil for drivers only serving the node service.
+func NewDriver(name, nodeID, endpoint string, cc *config.CloudCredentials, timeout int, vpcid string, options ...func(*Driver)) *Driver {
+	glog.Infof("Driver: %s version: %s", name, DriverVersion)
+
+	d := &Driver{
+		name:         name,
+		nodeID:       nodeID,
+		endpoint:     endpoint,
+		cloudconfig:  cc,
+		sharetimeout: timeout,
+		backoff:      sfs.DefaultBackoff,
+		mounter:      mount.New(""),
+	}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	// init backends for driver
+	sfs.InitBackends()
+
+	// init vpc for driver
+	if vpcid != "" {
+		d.vpcids = []string{vpcid}
+	} else if cc != nil {
+		vpcids, err := sfs.DiscoverLocalVPCs(*cc)
+		if err != nil {
+			glog.Warningf("Failed to discover vpcs of the local instance: %v", err)
+		}
+		d.vpcids = vpcids
+	}
+
+	if cc != nil {
+		d.addControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
+			csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+			csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
+			csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+		})
+	}
+	d.addVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+	})
+
+	return d
+}
+
+// Run serves the csi services until the server stops
+func (d *Driver) Run() {
+	s := NewNonBlockingGRPCServer()
+	var cs csi.ControllerServer
+	if d.cloudconfig != nil {
+		cs = NewControllerServer(d)
+	}
+	s.Start(d.endpoint, NewIdentityServer(d), cs, NewNodeServer(d))
+	s.Wait()
+}
+
+// addControllerServiceCapabilities of driver
+func (d *Driver) addControllerServiceCapabilities(cl []csi.ControllerServiceCapability_RPC_Type) {
+	var csc []*csi.ControllerServiceCapability
+	for _, c := range cl {
+		glog.Infof("Enabling controller service capability: %v", c.String())
+		csc = append(csc, &csi.ControllerServiceCapability{
+			Type: &csi.ControllerServiceCapability_Rpc{
+				Rpc: &csi.ControllerServiceCapability_RPC{
+					Type: c,
+				},
+			},
+		})
+	}
+	d.cscap = csc
+}
+
+// addVolumeCapabilityAccessModes of driver
+func (d *Driver) addVolumeCapabilityAccessModes(vc []csi.VolumeCapability_AccessMode_Mode) {
+	var vca []*csi.VolumeCapability_AccessMode
+	for _, c := range vc {
+		glog.Infof("Enabling volume access mode: %v", c.String())
+		vca = append(vca, &csi.VolumeCapability_AccessMode{Mode: c})
+	}
+	d.vcap = vca
+}
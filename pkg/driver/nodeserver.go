@@ -0,0 +1,147 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"os"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	volumeutil "k8s.io/kubernetes/pkg/volume/util"
+)
+
+// NodeServer implements csi.NodeServer
+type NodeServer struct {
+	driver *Driver
+}
+
+// NewNodeServer creates a new node server of the driver
+func NewNodeServer(d *Driver) *NodeServer {
+	return &NodeServer{driver: d}
+}
+
+// NodePublishVolume mounts the share at the target path
+func (ns *NodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	// check arguments
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID must be provided")
+	}
+	if req.GetTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Target path must be provided")
+	}
+	if req.GetVolumeCapability() == nil {
+		return nil, status.Error(codes.InvalidArgument, "Volume capability must be provided")
+	}
+	server := req.GetVolumeContext()[volumeContextServer]
+	path := req.GetVolumeContext()[volumeContextPath]
+	if server == "" || path == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Volume context of %s has no export location", req.GetVolumeId())
+	}
+
+	// check target path
+	target := req.GetTargetPath()
+	notMnt, err := ns.driver.mounter.IsLikelyNotMountPoint(target)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if err := os.MkdirAll(target, 0750); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		notMnt = true
+	}
+	if !notMnt {
+		glog.Infof("Volume %s is already mounted at %s", req.GetVolumeId(), target)
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	// build mount options
+	var options []string
+	if mnt := req.GetVolumeCapability().GetMount(); mnt != nil {
+		options = append(options, mnt.GetMountFlags()...)
+	}
+	if req.GetReadonly() || req.GetVolumeContext()[volumeContextReadOnly] == "true" {
+		options = append(options, "ro")
+	}
+
+	// mount share
+	source := server + ":" + path
+	glog.Infof("Mount %s at %s with options %v", source, target, options)
+	err = ns.driver.mounter.Mount(source, target, "nfs", options)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to mount %s at %s: %v", source, target, err)
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// NodeUnpublishVolume unmounts the share from the target path
+func (ns *NodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID must be provided")
+	}
+	if req.GetTargetPath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "Target path must be provided")
+	}
+
+	glog.Infof("Unmount volume %s from %s", req.GetVolumeId(), req.GetTargetPath())
+	err := volumeutil.UnmountPath(req.GetTargetPath(), ns.driver.mounter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Failed to unmount %s: %v", req.GetTargetPath(), err)
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// NodeGetInfo returns the id and the zone of the node
+func (ns *NodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	resp := &csi.NodeGetInfoResponse{
+		NodeId: ns.driver.nodeID,
+	}
+	if ns.driver.zone != "" {
+		resp.AccessibleTopology = zoneTopology(ns.driver.zone)[0]
+	}
+	return resp, nil
+}
+
+// NodeGetCapabilities returns the capabilities of the node service
+func (ns *NodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	return &csi.NodeGetCapabilitiesResponse{}, nil
+}
+
+// NodeStageVolume is not supported, shares are mounted per pod
+func (ns *NodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// NodeUnstageVolume is not supported, shares are unmounted per pod
+func (ns *NodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// NodeGetVolumeStats is not supported
+func (ns *NodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
+
+// NodeExpandVolume is not needed, shares are expanded by the controller service
+func (ns *NodeServer) NodeExpandVolume(ctx context.Context, req *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "")
+}
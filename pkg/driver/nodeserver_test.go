@@ -0,0 +1,49 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+)
+
+func TestNodeGetInfo(t *testing.T) {
+	tests := []struct {
+		zone     string
+		segments map[string]string
+	}{
+		{zone: ""},
+		{zone: "az-1", segments: map[string]string{topologyKeyZone: "az-1"}},
+	}
+
+	for _, test := range tests {
+		ns := NewNodeServer(NewDriver(DriverName, "node", "unix:///tmp/csi.sock", nil, 10, "vpc-1", Zone(test.zone)))
+		resp, err := ns.NodeGetInfo(context.Background(), &csi.NodeGetInfoRequest{})
+		if err != nil {
+			t.Fatalf("NodeGetInfo failed: %v", err)
+		}
+		if resp.GetNodeId() != "node" {
+			t.Errorf("Expected node id node, got %s", resp.GetNodeId())
+		}
+		segments := resp.GetAccessibleTopology().GetSegments()
+		if len(segments) != len(test.segments) || segments[topologyKeyZone] != test.segments[topologyKeyZone] {
+			t.Errorf("Zone %q: expected topology %v, got %v", test.zone, test.segments, segments)
+		}
+	}
+}
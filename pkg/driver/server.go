@@ -0,0 +1,150 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// NonBlockingGRPCServer defines non blocking GRPC server interfaces
+type NonBlockingGRPCServer interface {
+	// Start services at the endpoint
+	Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer)
+	// Wait for the service to stop
+	Wait()
+	// Stop the service gracefully
+	Stop()
+	// ForceStop stops the service forcefully
+	ForceStop()
+}
+
+// NewNonBlockingGRPCServer creates a new non blocking GRPC server
+func NewNonBlockingGRPCServer() NonBlockingGRPCServer {
+	return &nonBlockingGRPCServer{}
+}
+
+// nonBlockingGRPCServer implements NonBlockingGRPCServer
+type nonBlockingGRPCServer struct {
+	wg     sync.WaitGroup
+	server *grpc.Server
+}
+
+// Start services at the endpoint
+func (s *nonBlockingGRPCServer) Start(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
+	s.wg.Add(1)
+	go s.serve(endpoint, ids, cs, ns)
+}
+
+// Wait for the service to stop
+func (s *nonBlockingGRPCServer) Wait() {
+	s.wg.Wait()
+}
+
+// Stop the service gracefully
+func (s *nonBlockingGRPCServer) Stop() {
+	s.server.GracefulStop()
+}
+
+// ForceStop stops the service forcefully
+func (s *nonBlockingGRPCServer) ForceStop() {
+	s.server.Stop()
+}
+
+// serve registers the services and serves requests at the endpoint
+func (s *nonBlockingGRPCServer) serve(endpoint string, ids csi.IdentityServer, cs csi.ControllerServer, ns csi.NodeServer) {
+	defer s.wg.Done()
+
+	proto, addr, err := parseEndpoint(endpoint)
+	if err != nil {
+		glog.Fatal(err.Error())
+	}
+
+	if proto == "unix" {
+		if err := os.Remove(addr); err != nil && !os.IsNotExist(err) {
+			glog.Fatalf("Failed to remove %s, error: %s", addr, err.Error())
+		}
+	}
+
+	listener, err := net.Listen(proto, addr)
+	if err != nil {
+		glog.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(logGRPC))
+	s.server = server
+
+	if ids != nil {
+		csi.RegisterIdentityServer(server, ids)
+	}
+	if cs != nil {
+		csi.RegisterControllerServer(server, cs)
+	}
+	if ns != nil {
+		csi.RegisterNodeServer(server, ns)
+	}
+
+	glog.Infof("Listening for connections on address: %#v", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		glog.Errorf("Failed to serve: %v", err)
+	}
+}
+
+// parseEndpoint splits an endpoint like unix:///csi/csi.sock into protocol and address
+func parseEndpoint(endpoint string) (string, string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to parse endpoint %s: %v", endpoint, err)
+	}
+
+	addr := u.Host + u.Path
+	switch u.Scheme {
+	case "unix":
+		if addr == "" {
+			return "", "", fmt.Errorf("Invalid endpoint: %s", endpoint)
+		}
+		return u.Scheme, addr, nil
+	case "tcp":
+		if u.Host == "" {
+			return "", "", fmt.Errorf("Invalid endpoint: %s", endpoint)
+		}
+		return u.Scheme, u.Host, nil
+	}
+
+	return "", "", fmt.Errorf("Invalid endpoint scheme: %s", endpoint)
+}
+
+// logGRPC logs the requests and responses of the services
+func logGRPC(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	glog.V(3).Infof("GRPC call: %s", info.FullMethod)
+	glog.V(5).Infof("GRPC request: %+v", req)
+	resp, err := handler(ctx, req)
+	if err != nil {
+		glog.Errorf("GRPC error: %v", err)
+	} else {
+		glog.V(5).Infof("GRPC response: %+v", resp)
+	}
+	return resp, err
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/huaweicloud/external-sfs/pkg/sfs"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubeletapis "k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+const (
+	// gigabyte is the allocation unit of sfs shares
+	gigabyte int64 = 1000 * 1000 * 1000
+	// defaultVolumeSize is used when no capacity is requested
+	defaultVolumeSize = 1 * gigabyte
+
+	// volume context keys
+	volumeContextServer   = "server"
+	volumeContextPath     = "path"
+	volumeContextReadOnly = "readOnly"
+
+	// topologyKeyZone is the topology key of the availability zone of shares and nodes
+	topologyKeyZone = kubeletapis.LabelZoneFailureDomain
+)
+
+// requestedSize returns the capacity of the range rounded up to gigabytes
+func requestedSize(capRange *csi.CapacityRange) int64 {
+	size := capRange.GetRequiredBytes()
+	if size == 0 {
+		size = capRange.GetLimitBytes()
+	}
+	if size <= 0 {
+		return defaultVolumeSize
+	}
+	return (size + gigabyte - 1) / gigabyte * gigabyte
+}
+
+// buildVolumeOptions converts a csi request into the provisioner volume options
+// so that the share logic of the sfs package can be reused.
+func buildVolumeOptions(req *csi.CreateVolumeRequest, size int64) *controller.VolumeOptions {
+	return &controller.VolumeOptions{
+		PVName: req.GetName(),
+		PVC: &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				UID: types.UID(strings.TrimPrefix(req.GetName(), "pvc-")),
+			},
+			Spec: v1.PersistentVolumeClaimSpec{
+				AccessModes: buildAccessModes(req.GetVolumeCapabilities()),
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{
+						v1.ResourceStorage: *resource.NewQuantity(size, resource.DecimalSI),
+					},
+				},
+			},
+		},
+		Parameters: req.GetParameters(),
+	}
+}
+
+// buildAccessModes converts the access modes of the volume capabilities into claim access modes
+func buildAccessModes(caps []*csi.VolumeCapability) []v1.PersistentVolumeAccessMode {
+	var modes []v1.PersistentVolumeAccessMode
+	for _, c := range caps {
+		switch c.GetAccessMode().GetMode() {
+		case csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER:
+			modes = append(modes, v1.ReadWriteOnce)
+		case csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY, csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY:
+			modes = append(modes, v1.ReadOnlyMany)
+		case csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER, csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER:
+			modes = append(modes, v1.ReadWriteMany)
+		}
+	}
+	return modes
+}
+
+// shareContext returns a context of the request which expires after the share timeout
+func (d *Driver) shareContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, time.Duration(d.sharetimeout)*time.Second)
+}
+
+// shareErrorCode returns the code of a failed wait for a share
+func shareErrorCode(ctx context.Context) codes.Code {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return codes.DeadlineExceeded
+	case context.Canceled:
+		return codes.Canceled
+	}
+	return codes.Internal
+}
+
+// validateVolumeCapabilities checks the capabilities are supported by the driver
+func (d *Driver) validateVolumeCapabilities(caps []*csi.VolumeCapability) error {
+	for _, c := range caps {
+		if c.GetBlock() != nil {
+			return fmt.Errorf("Block access type is not supported")
+		}
+		if !d.supportsAccessMode(c.GetAccessMode().GetMode()) {
+			return fmt.Errorf("Access mode %s is not supported", c.GetAccessMode().GetMode())
+		}
+	}
+	return nil
+}
+
+// supportsAccessMode checks the access mode is supported by the driver
+func (d *Driver) supportsAccessMode(mode csi.VolumeCapability_AccessMode_Mode) bool {
+	for _, m := range d.vcap {
+		if m.GetMode() == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// validateProtocol checks the protocol of the parameters is served by the node service,
+// which only mounts nfs shares
+func validateProtocol(parameters map[string]string) error {
+	proto := parameters[sfs.SFSParametersProtocol]
+	if proto == "" {
+		proto = sfs.SFSParametersProtocolDefault
+	}
+	if proto != sfs.SFSParametersProtocolDefault {
+		return fmt.Errorf("Share protocol %s is not supported, only %s", proto, sfs.SFSParametersProtocolDefault)
+	}
+	return nil
+}
+
+// selectZone returns the availability zone of the share: the availability parameter, which must be
+// one of the requisite zones, or the first preferred or requisite zone of the accessibility requirements
+func selectZone(parameters map[string]string, requirements *csi.TopologyRequirement) (string, error) {
+	requisite := topologyZones(requirements.GetRequisite())
+	zone := parameters[sfs.SFSParametersAvailability]
+	if zone == "" {
+		if preferred := topologyZones(requirements.GetPreferred()); len(preferred) > 0 {
+			return preferred[0], nil
+		}
+		if len(requisite) > 0 {
+			return requisite[0], nil
+		}
+		return "", nil
+	}
+
+	if len(requisite) == 0 {
+		return zone, nil
+	}
+	for _, z := range requisite {
+		if z == zone {
+			return zone, nil
+		}
+	}
+	return "", fmt.Errorf("Zone %s of parameter %s is not one of the requisite zones %v",
+		zone, sfs.SFSParametersAvailability, requisite)
+}
+
+// topologyZones returns the zones of the topologies
+func topologyZones(topologies []*csi.Topology) []string {
+	var zones []string
+	for _, t := range topologies {
+		if zone := t.GetSegments()[topologyKeyZone]; zone != "" {
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// zoneTopology returns the topology of the zone
+func zoneTopology(zone string) []*csi.Topology {
+	return []*csi.Topology{
+		{Segments: map[string]string{topologyKeyZone: zone}},
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"k8s.io/api/core/v1"
+)
+
+// access rule types of the accessRules parameter and their sfs access types
+var accessRuleTypes = map[string]string{
+	"vpc": "cert",
+	"ip":  "ip",
+}
+
+// ParseAccessRules parses the accessRules parameter, a comma separated list of
+// vpc:<vpc id>[:<level>] and ip:<ip or cidr>[:<level>] rules, the level is rw or ro and defaults to rw.
+func ParseAccessRules(parameters map[string]string) ([]backends.Access, error) {
+	value := parameters[SFSParametersAccessRules]
+	if value == "" {
+		return nil, nil
+	}
+
+	var accesses []backends.Access
+	for _, rule := range strings.Split(value, ",") {
+		rule = strings.TrimSpace(rule)
+		parts := strings.SplitN(rule, ":", 2)
+		accessType, ok := accessRuleTypes[parts[0]]
+		if !ok || len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid access rule %q, must be vpc:<vpc id>[:<level>] or ip:<ip or cidr>[:<level>]", rule)
+		}
+
+		// an IPv6 rule contains colons, so the level is only split off if it is one
+		to, level := parts[1], "rw"
+		if pos := strings.LastIndexByte(to, ':'); pos >= 0 && (to[pos+1:] == "rw" || to[pos+1:] == "ro") {
+			to, level = to[:pos], to[pos+1:]
+		}
+		if to == "" {
+			return nil, fmt.Errorf("Invalid access rule %q, target is missing", rule)
+		}
+		if accessType == "ip" && net.ParseIP(to) == nil {
+			if _, _, err := net.ParseCIDR(to); err != nil {
+				return nil, fmt.Errorf("Invalid access rule %q, %s is no ip or cidr", rule, to)
+			}
+		}
+		accesses = append(accesses, backends.Access{AccessType: accessType, AccessTo: to, AccessLevel: level})
+	}
+	return accesses, nil
+}
+
+// ErrNoVPC is returned when neither the class nor the cluster has a vpc
+var ErrNoVPC = errors.New("No vpc of the cluster could be resolved, set the vpcid parameter of the class")
+
+// VPCAccess returns the access rules of the vpc of the class or the vpcs of the cluster
+func VPCAccess(volOptions *controller.VolumeOptions, vpcids []string) ([]backends.Access, error) {
+	readOnly, err := IsReadOnly(volOptions)
+	if err != nil {
+		return nil, err
+	}
+	if id := volOptions.Parameters[SFSParametersVPCID]; id != "" {
+		vpcids = []string{id}
+	}
+	if len(vpcids) == 0 {
+		return nil, ErrNoVPC
+	}
+
+	var accesses []backends.Access
+	for _, id := range vpcids {
+		accesses = append(accesses, backends.Access{AccessType: "cert", AccessTo: id, AccessLevel: accessLevel(readOnly)})
+	}
+	return accesses, nil
+}
+
+// IsReadOnly checks whether the share is exported read only,
+// because the class forces it or the claim only requests ReadOnlyMany.
+func IsReadOnly(volOptions *controller.VolumeOptions) (bool, error) {
+	if value := volOptions.Parameters[SFSParametersReadOnly]; value != "" {
+		force, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("Invalid %s %s: %v", SFSParametersReadOnly, value, err)
+		}
+		if force {
+			return true, nil
+		}
+	}
+
+	modes := volOptions.PVC.Spec.AccessModes
+	if len(modes) == 0 {
+		return false, nil
+	}
+	for _, m := range modes {
+		if m != v1.ReadOnlyMany {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// accessLevel returns the sfs access level of a read only or read write export
+func accessLevel(readOnly bool) string {
+	if readOnly {
+		return "ro"
+	}
+	return "rw"
+}
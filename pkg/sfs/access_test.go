@@ -0,0 +1,85 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+)
+
+func TestParseAccessRules(t *testing.T) {
+	tests := []struct {
+		rules    string
+		accesses []backends.Access
+		valid    bool
+	}{
+		{rules: "", valid: true},
+		{
+			rules:    "vpc:vpc-1",
+			accesses: []backends.Access{{AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "rw"}},
+			valid:    true,
+		},
+		{
+			rules: "vpc:vpc-1:ro, ip:10.0.0.0/24",
+			accesses: []backends.Access{
+				{AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "ro"},
+				{AccessType: "ip", AccessTo: "10.0.0.0/24", AccessLevel: "rw"},
+			},
+			valid: true,
+		},
+		{
+			rules:    "ip:192.168.0.10:ro",
+			accesses: []backends.Access{{AccessType: "ip", AccessTo: "192.168.0.10", AccessLevel: "ro"}},
+			valid:    true,
+		},
+		{
+			rules:    "ip:fd00::/64",
+			accesses: []backends.Access{{AccessType: "ip", AccessTo: "fd00::/64", AccessLevel: "rw"}},
+			valid:    true,
+		},
+		{
+			rules:    "ip:fd00::1:ro",
+			accesses: []backends.Access{{AccessType: "ip", AccessTo: "fd00::1", AccessLevel: "ro"}},
+			valid:    true,
+		},
+		{rules: "ip:10.0.0.0/33", valid: false},
+		{rules: "ip:10.0.0.256/24", valid: false},
+		{rules: "ip:10.0.0.0/", valid: false},
+		{rules: "ip:fd00::/129", valid: false},
+		{rules: "ip:192.168.0.300", valid: false},
+		{rules: "ip:sfs-nas1", valid: false},
+		{rules: "ip:10.0.0.0/24:rx", valid: false},
+		{rules: "ip:", valid: false},
+		{rules: "vpc::ro", valid: false},
+		{rules: "vpc", valid: false},
+		{rules: "nfs:vpc-1", valid: false},
+		{rules: "vpc:vpc-1,", valid: false},
+	}
+
+	for _, test := range tests {
+		accesses, err := ParseAccessRules(map[string]string{SFSParametersAccessRules: test.rules})
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%q: expected valid %v, got %v", test.rules, test.valid, err)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(accesses, test.accesses) {
+			t.Errorf("%q: expected %+v, got %+v", test.rules, test.accesses, accesses)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// adoptableShare returns the existing share to adopt for the claim after checking
+// its status, protocol and size, and that it is not used by another volume.
+func (p *Provisioner) adoptableShare(client *golangsdk.ServiceClient, volOptions *controller.VolumeOptions, shareID string) (*shares.Share, error) {
+	share, err := GetShare(client, shareID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get share %s to adopt: %v", shareID, err)
+	}
+	if share.Status != SFSStatusAvailable {
+		return nil, fmt.Errorf("Share %s to adopt is %s instead of %s", shareID, share.Status, SFSStatusAvailable)
+	}
+	if share.Metadata[SFSMetadataRecycledAt] != "" {
+		return nil, fmt.Errorf("Share %s is in the recycle bin, restore it with the annotation %s", shareID, SFSAnnotationRestoreShare)
+	}
+
+	protocol := volOptions.Parameters[SFSParametersProtocol]
+	if protocol == "" {
+		protocol = SFSParametersProtocolDefault
+	}
+	if !strings.EqualFold(share.ShareProto, protocol) {
+		return nil, fmt.Errorf("Share %s to adopt has protocol %s instead of %s", shareID, share.ShareProto, protocol)
+	}
+	if err := validateShareSize(share, volOptions.PVC); err != nil {
+		return nil, err
+	}
+
+	referenced, err := ReferencedShares(p.clientset)
+	if err != nil {
+		return nil, err
+	}
+	if referenced[shareID] {
+		return nil, fmt.Errorf("Share %s to adopt is already used by a persistent volume", shareID)
+	}
+	return share, nil
+}
+
+// adoptedAnnotations records in the annotations of the volume whether the adopted share is deleted
+// with the volume, or kept and only the access rules granted by the provision are revoked.
+func adoptedAnnotations(annotations, parameters map[string]string, grantedIDs []string) error {
+	deleteShare := false
+	if value := parameters[SFSParametersDeleteAdopted]; value != "" {
+		var err error
+		deleteShare, err = strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s %s: %v", SFSParametersDeleteAdopted, value, err)
+		}
+	}
+
+	annotations[SFSAnnotationAdopted] = "true"
+	if !deleteShare {
+		annotations[SFSAnnotationKeepShare] = "true"
+		annotations[SFSAnnotationGrantedAccess] = strings.Join(grantedIDs, ",")
+	}
+	return nil
+}
+
+// releaseShare revokes the access rules granted to the adopted share of a deleted volume
+func (p *Provisioner) releaseShare(client *golangsdk.ServiceClient, pv *v1.PersistentVolume, shareID string) error {
+	for _, accessID := range strings.Split(pv.Annotations[SFSAnnotationGrantedAccess], ",") {
+		if accessID == "" {
+			continue
+		}
+		glog.Infof("Revoke access %s of released share %s", accessID, shareID)
+		err := RevokeAccess(client, shareID, accessID)
+		if _, ok := err.(golangsdk.ErrDefault404); err != nil && !ok {
+			return fmt.Errorf("Failed to revoke access %s: %v", accessID, err)
+		}
+	}
+
+	p.recorder.Eventf(pv, v1.EventTypeNormal, SFSEventShareReleased,
+		"Adopted share %s is kept, the access rules granted to the cluster are revoked", shareID)
+	return nil
+}
+
+// existingAccess returns the keys of the access rules of the share
+func existingAccess(client *golangsdk.ServiceClient, shareID string) (map[string]bool, error) {
+	rights, err := shares.ListAccessRights(client, shareID).ExtractAccessRights()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list access rules of share %s: %v", shareID, err)
+	}
+	existing := map[string]bool{}
+	for _, right := range rights {
+		existing[accessKey(right.AccessType, right.AccessTo)] = true
+	}
+	return existing, nil
+}
+
+// validateShareSize checks that an existing share provides the capacity requested by the claim
+func validateShareSize(share *shares.Share, pvc *v1.PersistentVolumeClaim) error {
+	requested := pvc.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)]
+	if requested.Cmp(shareCapacity(share)) > 0 {
+		return fmt.Errorf("Share %s of %dGB is smaller than the requested %s", share.ID, share.Size, requested.String())
+	}
+	return nil
+}
+
+// shareCapacity returns the size of the share as capacity, shares are sized in GB like the requests
+func shareCapacity(share *shares.Share) resource.Quantity {
+	return *resource.NewScaledQuantity(int64(share.Size), resource.Giga)
+}
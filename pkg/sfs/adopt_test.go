@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"testing"
+
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestShareCapacity(t *testing.T) {
+	capacity := shareCapacity(&shares.Share{Size: 10})
+	if capacity.String() != "10G" {
+		t.Errorf("Expected capacity 10G, got %s", capacity.String())
+	}
+}
+
+func TestValidateShareSize(t *testing.T) {
+	tests := []struct {
+		requested string
+		valid     bool
+	}{
+		{requested: "10G", valid: true},
+		{requested: "9Gi", valid: true},
+		{requested: "10Gi", valid: false},
+		{requested: "11G", valid: false},
+	}
+
+	share := &shares.Share{ID: "share-1", Size: 10}
+	for _, test := range tests {
+		pvc := &v1.PersistentVolumeClaim{
+			Spec: v1.PersistentVolumeClaimSpec{
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse(test.requested)},
+				},
+			},
+		}
+		err := validateShareSize(share, pvc)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("Request of %s: expected valid %v, got %v", test.requested, test.valid, err)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package sfs
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
 )
@@ -30,6 +31,8 @@ var (
 func InitBackends() {
 	caches = make(map[string]backends.Backend)
 	RegisterBackend(&backends.NFSBackend{})
+	RegisterBackend(&backends.CIFSBackend{})
+	RegisterBackend(&backends.CSINFSBackend{})
 }
 
 // RegisterBackend for share
@@ -45,3 +48,24 @@ func GetBackend(name string) (backends.Backend, error) {
 	}
 	return b, nil
 }
+
+// SelectBackend of the protocol and backend parameters of a class
+func SelectBackend(parameters map[string]string) (backends.Backend, error) {
+	protocol := parameters[SFSParametersProtocol]
+	if protocol == "" {
+		protocol = SFSParametersProtocolDefault
+	}
+	// backends are named after their protocol, alternatives have a suffix such as NFS-CSI
+	name := parameters[SFSParametersBackend]
+	if name == "" {
+		name = protocol
+	}
+	if name != protocol && !strings.HasPrefix(name, protocol+"-") {
+		return nil, fmt.Errorf("Backend %s does not support protocol %s", name, protocol)
+	}
+	b, err := GetBackend(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backend: %v", err)
+	}
+	return b, nil
+}
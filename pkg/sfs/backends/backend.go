@@ -27,9 +27,27 @@ type Backend interface {
 
 	// Called during share provision, the result is used in the final PersistentVolume object.
 	BuildSource(*BuildSourceArgs) (*v1.PersistentVolumeSource, error)
+
+	// Called before share provision, merges the mount options with the backend defaults
+	// and rejects invalid ones. The result is used as the mount options of the PersistentVolume.
+	BuildMountOptions(*BuildSourceArgs) ([]string, error)
+
+	// Called before share provision, returns the access rules required by the protocol
+	// in addition to the one of the vpc. The rules are granted after the share is created.
+	BuildAccess(*BuildSourceArgs) ([]Access, error)
+}
+
+// Access is an access rule of a share
+type Access struct {
+	AccessType  string
+	AccessTo    string
+	AccessLevel string
 }
 
 // BuildSourceArgs contains arguments
 type BuildSourceArgs struct {
-	Location string
+	Location     string
+	MountOptions []string
+	Parameters   map[string]string
+	ReadOnly     bool
 }
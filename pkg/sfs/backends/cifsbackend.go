@@ -0,0 +1,228 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+)
+
+// Defines the storage class parameters of CIFS shares
+const (
+	CIFSParametersSourceType      = "cifsSourceType"
+	CIFSParametersDriver          = "cifsDriver"
+	CIFSParametersSecretName      = "cifsSecretName"
+	CIFSParametersSecretNamespace = "cifsSecretNamespace"
+	CIFSParametersAccessType      = "cifsAccessType"
+	CIFSParametersAccessTo        = "cifsAccessTo"
+)
+
+// Defines the volume sources of CIFS shares
+const (
+	CIFSSourceTypeFlexVolume = "FlexVolume"
+	CIFSSourceTypeCSI        = "CSI"
+)
+
+// Defines the default drivers of CIFS shares
+const (
+	cifsDefaultFlexVolumeDriver = "fstab/cifs"
+	cifsDefaultCSIDriver        = "smb.csi.k8s.io"
+)
+
+// cifsDefaultMountOptions are the mount options recommended for sfs shares
+var cifsDefaultMountOptions = []string{"vers=3.0"}
+
+// cifsVersions are the supported SMB protocol versions
+var cifsVersions = []string{"1.0", "2.0", "2.1", "3.0", "3.02", "3.1.1"}
+
+// cifsCredentialMountOptions are the options which must be set in the secret instead
+var cifsCredentialMountOptions = map[string]bool{
+	"user": true, "username": true, "pass": true, "password": true, "credentials": true,
+}
+
+// CIFSBackend for share
+type CIFSBackend struct {
+	Backend
+}
+
+// Name of the backend
+func (b *CIFSBackend) Name() string {
+	return "CIFS"
+}
+
+// BuildSource builds PersistentVolumeSource of a CIFS FlexVolume or CSI SMB driver,
+// which mount the share with the username and password of the referenced secret.
+func (b *CIFSBackend) BuildSource(args *BuildSourceArgs) (*v1.PersistentVolumeSource, error) {
+	server, share, err := parseUNCLocation(args.Location)
+	if err != nil {
+		return &v1.PersistentVolumeSource{}, err
+	}
+	networkPath := "//" + server + "/" + share
+
+	name := args.Parameters[CIFSParametersSecretName]
+	namespace := args.Parameters[CIFSParametersSecretNamespace]
+	if name == "" || namespace == "" {
+		return &v1.PersistentVolumeSource{},
+			fmt.Errorf("both %s and %s must be set for CIFS shares", CIFSParametersSecretName, CIFSParametersSecretNamespace)
+	}
+	secretRef := &v1.SecretReference{Name: name, Namespace: namespace}
+
+	driver := args.Parameters[CIFSParametersDriver]
+	switch sourceType := args.Parameters[CIFSParametersSourceType]; sourceType {
+	case "", CIFSSourceTypeFlexVolume:
+		if driver == "" {
+			driver = cifsDefaultFlexVolumeDriver
+		}
+		return &v1.PersistentVolumeSource{
+			FlexVolume: &v1.FlexPersistentVolumeSource{
+				Driver:    driver,
+				SecretRef: secretRef,
+				ReadOnly:  args.ReadOnly,
+				Options: map[string]string{
+					"networkPath":  networkPath,
+					"mountOptions": strings.Join(args.MountOptions, ","),
+				},
+			},
+		}, nil
+	case CIFSSourceTypeCSI:
+		if driver == "" {
+			driver = cifsDefaultCSIDriver
+		}
+		return &v1.PersistentVolumeSource{
+			CSI: &v1.CSIPersistentVolumeSource{
+				Driver:       driver,
+				VolumeHandle: networkPath,
+				ReadOnly:     args.ReadOnly,
+				VolumeAttributes: map[string]string{
+					"source": networkPath,
+				},
+				NodeStageSecretRef: secretRef,
+			},
+		}, nil
+	default:
+		return &v1.PersistentVolumeSource{},
+			fmt.Errorf("unsupported %s %s", CIFSParametersSourceType, sourceType)
+	}
+}
+
+// BuildMountOptions merges the mount options with the defaults of CIFS
+func (b *CIFSBackend) BuildMountOptions(args *BuildSourceArgs) ([]string, error) {
+	options, err := splitMountOptions(args.MountOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range options {
+		if err := validateCIFSMountOption(o); err != nil {
+			return nil, err
+		}
+	}
+	return mergeMountOptions(cifsDefaultMountOptions, options), nil
+}
+
+// BuildAccess returns the user or ip access rules of the parameters
+func (b *CIFSBackend) BuildAccess(args *BuildSourceArgs) ([]Access, error) {
+	to := args.Parameters[CIFSParametersAccessTo]
+	if to == "" {
+		return nil, nil
+	}
+
+	accessType := args.Parameters[CIFSParametersAccessType]
+	if accessType == "" {
+		accessType = "user"
+	}
+	if accessType != "user" && accessType != "ip" {
+		return nil, fmt.Errorf("unsupported %s %s, must be user or ip", CIFSParametersAccessType, accessType)
+	}
+
+	var accesses []Access
+	for _, t := range strings.Split(to, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			return nil, fmt.Errorf("empty access target in %s %q", CIFSParametersAccessTo, to)
+		}
+		if accessType == "ip" && net.ParseIP(t) == nil {
+			if _, _, err := net.ParseCIDR(t); err != nil {
+				return nil, fmt.Errorf("invalid ip access target %q", t)
+			}
+		}
+		level := "rw"
+		if args.ReadOnly {
+			level = "ro"
+		}
+		accesses = append(accesses, Access{AccessType: accessType, AccessTo: t, AccessLevel: level})
+	}
+	return accesses, nil
+}
+
+// parseUNCLocation returns the server and share of a \\server\share or //server/share location
+func parseUNCLocation(location string) (string, string, error) {
+	path := strings.Replace(location, "\\", "/", -1)
+	if !strings.HasPrefix(path, "//") {
+		return "", "", fmt.Errorf("failed to parse UNC export location '%s'", location)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(path, "//"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.Trim(parts[1], "/") == "" {
+		return "", "", fmt.Errorf("failed to parse server and share from export location '%s'", location)
+	}
+	if err := validateLocationHost(parts[0]); err != nil {
+		return "", "", fmt.Errorf("invalid export location '%s': %v", location, err)
+	}
+	if err := validateLocationPath("/" + parts[1]); err != nil {
+		return "", "", fmt.Errorf("invalid export location '%s': %v", location, err)
+	}
+	return parts[0], strings.Trim(parts[1], "/"), nil
+}
+
+// validateCIFSMountOption rejects credentials and the options with an invalid value
+func validateCIFSMountOption(option string) error {
+	parts := strings.SplitN(option, "=", 2)
+	key := parts[0]
+	if key == "" {
+		return fmt.Errorf("invalid mount option %q", option)
+	}
+	if cifsCredentialMountOptions[key] {
+		return fmt.Errorf("mount option %q must be set in the secret %s", key, CIFSParametersSecretName)
+	}
+	if len(parts) == 1 {
+		return nil
+	}
+
+	value := parts[1]
+	switch key {
+	case "vers":
+		for _, v := range cifsVersions {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("mount option %q requires one of %s", option, strings.Join(cifsVersions, ", "))
+	case "file_mode", "dir_mode":
+		if _, err := strconv.ParseUint(value, 8, 32); err != nil {
+			return fmt.Errorf("mount option %q requires an octal mode", option)
+		}
+	case "rsize", "wsize", "actimeo":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("mount option %q requires a non-negative integer", option)
+		}
+	}
+	return nil
+}
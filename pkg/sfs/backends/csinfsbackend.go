@@ -0,0 +1,63 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// NFSParametersDriver is the storage class parameter of the NFS CSI driver name
+const NFSParametersDriver = "nfsDriver"
+
+// nfsDefaultCSIDriver is the name of the upstream NFS CSI driver
+const nfsDefaultCSIDriver = "nfs.csi.k8s.io"
+
+// CSINFSBackend for share, mounts NFS shares with the NFS CSI driver instead of the in-tree NFS plugin.
+// The mount options and access rules are the ones of NFS.
+type CSINFSBackend struct {
+	NFSBackend
+}
+
+// Name of the backend
+func (b *CSINFSBackend) Name() string {
+	return "NFS-CSI"
+}
+
+// BuildSource builds PersistentVolumeSource for the NFS CSI driver
+func (b *CSINFSBackend) BuildSource(args *BuildSourceArgs) (*v1.PersistentVolumeSource, error) {
+	server, path, err := parseNFSLocation(args.Location)
+	if err != nil {
+		return &v1.PersistentVolumeSource{}, err
+	}
+
+	driver := args.Parameters[NFSParametersDriver]
+	if driver == "" {
+		driver = nfsDefaultCSIDriver
+	}
+
+	return &v1.PersistentVolumeSource{
+		CSI: &v1.CSIPersistentVolumeSource{
+			Driver:       driver,
+			VolumeHandle: server + "#" + path,
+			ReadOnly:     args.ReadOnly,
+			VolumeAttributes: map[string]string{
+				"server": server,
+				"share":  path,
+			},
+		},
+	}, nil
+}
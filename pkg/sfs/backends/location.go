@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// LocationHost returns the host of a server:/path or UNC export location,
+// an IPv6 address is returned without brackets.
+func LocationHost(location string) (string, error) {
+	if strings.HasPrefix(location, "\\\\") || strings.HasPrefix(location, "//") {
+		server, _, err := parseUNCLocation(location)
+		return server, err
+	}
+	server, _, err := parseNFSLocation(location)
+	return strings.Trim(server, "[]"), err
+}
+
+// parseNFSLocation returns the server and path of a host:/path, ipv4:/path, [ipv6]:/path
+// or ipv6:/path location. An IPv6 server is returned in brackets, so that server:path
+// is a valid mount source.
+func parseNFSLocation(location string) (string, string, error) {
+	// the path starts at the first slash, which must follow the host delimiter
+	slashPos := strings.IndexByte(location, '/')
+	if slashPos <= 1 || location[slashPos-1] != ':' {
+		return "", "", fmt.Errorf("failed to parse address and location from export location '%s'", location)
+	}
+	host := location[:slashPos-1]
+	path := location[slashPos:]
+
+	if strings.HasPrefix(host, "[") || strings.HasSuffix(host, "]") {
+		if !strings.HasPrefix(host, "[") || !strings.HasSuffix(host, "]") {
+			return "", "", fmt.Errorf("unbalanced brackets in export location '%s'", location)
+		}
+		host = host[1 : len(host)-1]
+		if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+			return "", "", fmt.Errorf("invalid IPv6 address in export location '%s'", location)
+		}
+	}
+	if err := validateLocationHost(host); err != nil {
+		return "", "", fmt.Errorf("invalid export location '%s': %v", location, err)
+	}
+	if err := validateLocationPath(path); err != nil {
+		return "", "", fmt.Errorf("invalid export location '%s': %v", location, err)
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+	return host, path, nil
+}
+
+// validateLocationHost checks that the host is an ip address or a hostname
+func validateLocationHost(host string) error {
+	if host == "" {
+		return fmt.Errorf("empty host")
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if len(host) > 253 {
+		return fmt.Errorf("host %s is too long", host)
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid hostname %s", host)
+		}
+		for _, c := range label {
+			if !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') && c != '-' && c != '_' {
+				return fmt.Errorf("invalid hostname %s", host)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLocationPath checks that the path is absolute and has no parent references or blanks
+func validateLocationPath(path string) error {
+	if !strings.HasPrefix(path, "/") || strings.Trim(path, "/") == "" {
+		return fmt.Errorf("invalid path %s", path)
+	}
+	if strings.ContainsAny(path, " \t\r\n") {
+		return fmt.Errorf("path %s contains whitespace", path)
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == ".." {
+			return fmt.Errorf("path %s contains parent references", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"testing"
+)
+
+func TestParseNFSLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		server   string
+		path     string
+		valid    bool
+	}{
+		{location: "192.168.0.10:/share-1", server: "192.168.0.10", path: "/share-1", valid: true},
+		{location: "[fd00::1]:/share-1", server: "[fd00::1]", path: "/share-1", valid: true},
+		{location: "fd00::1:/share-1", server: "[fd00::1]", path: "/share-1", valid: true},
+		{location: "[fd00::1]:/share-1/sub", server: "[fd00::1]", path: "/share-1/sub", valid: true},
+		{location: "sfs-nas1.example.com:/share-1", server: "sfs-nas1.example.com", path: "/share-1", valid: true},
+		{location: "sfs_nas1:/share-1", server: "sfs_nas1", path: "/share-1", valid: true},
+		{location: "[fd00::1:/share-1", valid: false},
+		{location: "fd00::1]:/share-1", valid: false},
+		{location: "[192.168.0.10]:/share-1", valid: false},
+		{location: "[sfs-nas1]:/share-1", valid: false},
+		{location: "-sfs-nas1:/share-1", valid: false},
+		{location: "sfs..example.com:/share-1", valid: false},
+		{location: "sfs nas1:/share-1", valid: false},
+		{location: "192.168.0.10:/share-1/../etc", valid: false},
+		{location: "192.168.0.10:/..", valid: false},
+		{location: "192.168.0.10:/share 1", valid: false},
+		{location: "192.168.0.10:/", valid: false},
+		{location: "192.168.0.10/share-1", valid: false},
+		{location: ":/share-1", valid: false},
+		{location: "/share-1", valid: false},
+		{location: "", valid: false},
+	}
+
+	for _, test := range tests {
+		server, path, err := parseNFSLocation(test.location)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.location, test.valid, err)
+			continue
+		}
+		if server != test.server || path != test.path {
+			t.Errorf("%s: expected %s %s, got %s %s", test.location, test.server, test.path, server, path)
+		}
+	}
+}
+
+func TestParseUNCLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		server   string
+		share    string
+		valid    bool
+	}{
+		{location: "\\\\192.168.0.10\\share-1", server: "192.168.0.10", share: "share-1", valid: true},
+		{location: "//192.168.0.10/share-1", server: "192.168.0.10", share: "share-1", valid: true},
+		{location: "//sfs-nas1.example.com/share-1/", server: "sfs-nas1.example.com", share: "share-1", valid: true},
+		{location: "\\\\sfs-nas1\\share-1\\sub", server: "sfs-nas1", share: "share-1/sub", valid: true},
+		{location: "//fd00::1/share-1", server: "fd00::1", share: "share-1", valid: true},
+		{location: "//sfs-nas1/share-1/../share-2", valid: false},
+		{location: "\\\\sfs-nas1\\..", valid: false},
+		{location: "//sfs nas1/share-1", valid: false},
+		{location: "//-sfs-nas1/share-1", valid: false},
+		{location: "//sfs-nas1/share 1", valid: false},
+		{location: "//sfs-nas1/", valid: false},
+		{location: "//sfs-nas1", valid: false},
+		{location: "///share-1", valid: false},
+		{location: "sfs-nas1/share-1", valid: false},
+	}
+
+	for _, test := range tests {
+		server, share, err := parseUNCLocation(test.location)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.location, test.valid, err)
+			continue
+		}
+		if server != test.server || share != test.share {
+			t.Errorf("%s: expected %s %s, got %s %s", test.location, test.server, test.share, server, share)
+		}
+	}
+}
+
+func TestLocationHost(t *testing.T) {
+	tests := []struct {
+		location string
+		host     string
+	}{
+		{location: "192.168.0.10:/share-1", host: "192.168.0.10"},
+		{location: "[fd00::1]:/share-1", host: "fd00::1"},
+		{location: "fd00::1:/share-1", host: "fd00::1"},
+		{location: "\\\\sfs-nas1\\share-1", host: "sfs-nas1"},
+	}
+
+	for _, test := range tests {
+		host, err := LocationHost(test.location)
+		if err != nil || host != test.host {
+			t.Errorf("%s: expected host %s, got %s %v", test.location, test.host, host, err)
+		}
+	}
+}
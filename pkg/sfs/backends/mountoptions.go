@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitMountOptions splits comma separated options and rejects empty or blank ones
+func splitMountOptions(options []string) ([]string, error) {
+	var result []string
+	for _, option := range options {
+		for _, o := range strings.Split(option, ",") {
+			if o == "" {
+				return nil, fmt.Errorf("empty mount option in %q", option)
+			}
+			if strings.ContainsAny(o, " \t\n") {
+				return nil, fmt.Errorf("mount option %q contains whitespace", o)
+			}
+			result = append(result, o)
+		}
+	}
+	return result, nil
+}
+
+// mountOptionAliases maps the aliases of options to their canonical key
+var mountOptionAliases = map[string]string{
+	"nfsvers": "vers",
+}
+
+// mountOptionKey returns the key of an option, negated flags and aliases share the key of the option
+func mountOptionKey(option string) string {
+	key := strings.SplitN(option, "=", 2)[0]
+	if !strings.Contains(option, "=") {
+		key = strings.TrimPrefix(key, "no")
+	}
+	if alias, ok := mountOptionAliases[key]; ok {
+		key = alias
+	}
+	return key
+}
+
+// mergeMountOptions returns the defaults overridden by the options with the same key
+func mergeMountOptions(defaults []string, options []string) []string {
+	overridden := map[string]bool{}
+	for _, o := range options {
+		overridden[mountOptionKey(o)] = true
+	}
+
+	var result []string
+	for _, d := range defaults {
+		if !overridden[mountOptionKey(d)] {
+			result = append(result, d)
+		}
+	}
+	return append(result, options...)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backends
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeMountOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults []string
+		options  []string
+		merged   []string
+	}{
+		{
+			name:     "no options",
+			defaults: []string{"vers=3", "timeo=600", "nolock"},
+			merged:   []string{"vers=3", "timeo=600", "nolock"},
+		},
+		{
+			name:     "negated flag overrides the flag",
+			defaults: []string{"vers=3", "lock"},
+			options:  []string{"nolock"},
+			merged:   []string{"vers=3", "nolock"},
+		},
+		{
+			name:     "flag overrides the negated flag",
+			defaults: []string{"nolock", "hard"},
+			options:  []string{"lock"},
+			merged:   []string{"hard", "lock"},
+		},
+		{
+			name:     "negated flag overrides the negated flag",
+			defaults: []string{"noresvport"},
+			options:  []string{"noresvport"},
+			merged:   []string{"noresvport"},
+		},
+		{
+			name:     "value starting with no is not negated",
+			defaults: []string{"sec=sys", "nolock"},
+			options:  []string{"sec=none"},
+			merged:   []string{"nolock", "sec=none"},
+		},
+		{
+			name:     "alias overrides the option",
+			defaults: []string{"vers=3", "nolock"},
+			options:  []string{"nfsvers=4.1"},
+			merged:   []string{"nolock", "nfsvers=4.1"},
+		},
+		{
+			name:     "value overrides the value",
+			defaults: []string{"timeo=600", "noresvport"},
+			options:  []string{"timeo=300"},
+			merged:   []string{"noresvport", "timeo=300"},
+		},
+	}
+
+	for _, test := range tests {
+		if merged := mergeMountOptions(test.defaults, test.options); !reflect.DeepEqual(merged, test.merged) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.merged, merged)
+		}
+	}
+}
+
+func TestSplitMountOptions(t *testing.T) {
+	tests := []struct {
+		options []string
+		split   []string
+		valid   bool
+	}{
+		{options: []string{"vers=3,nolock", "hard"}, split: []string{"vers=3", "nolock", "hard"}, valid: true},
+		{options: []string{"vers=3,,nolock"}, valid: false},
+		{options: []string{""}, valid: false},
+		{options: []string{"vers=3, nolock"}, valid: false},
+	}
+
+	for _, test := range tests {
+		split, err := splitMountOptions(test.options)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%v: expected valid %v, got %v", test.options, test.valid, err)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(split, test.split) {
+			t.Errorf("%v: expected %v, got %v", test.options, test.split, split)
+		}
+	}
+}
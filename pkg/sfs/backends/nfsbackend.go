@@ -18,11 +18,29 @@ package backends
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"k8s.io/api/core/v1"
 )
 
+// nfsDefaultMountOptions are the mount options recommended for sfs shares
+var nfsDefaultMountOptions = []string{"vers=3", "timeo=600", "nolock"}
+
+// nfsNumericMountOptions are the options which take a non-negative integer
+var nfsNumericMountOptions = map[string]bool{
+	"timeo": true, "retrans": true, "retry": true, "rsize": true, "wsize": true, "port": true,
+	"acregmin": true, "acregmax": true, "acdirmin": true, "acdirmax": true, "actimeo": true,
+}
+
+// nfsEnumMountOptions are the options which take one of a set of values
+var nfsEnumMountOptions = map[string][]string{
+	"vers":    {"3", "4", "4.0", "4.1", "4.2"},
+	"nfsvers": {"3", "4", "4.0", "4.1", "4.2"},
+	"proto":   {"tcp", "tcp6", "udp", "udp6", "rdma"},
+	"sec":     {"sys", "none", "krb5", "krb5i", "krb5p"},
+}
+
 // NFSBackend for share
 type NFSBackend struct {
 	Backend
@@ -35,20 +53,66 @@ func (b *NFSBackend) Name() string {
 
 // BuildSource builds PersistentVolumeSource for k8s NFS
 func (b *NFSBackend) BuildSource(args *BuildSourceArgs) (*v1.PersistentVolumeSource, error) {
-	delimPos := strings.LastIndexByte(args.Location, ':')
-	if delimPos <= 0 {
-		return &v1.PersistentVolumeSource{},
-			fmt.Errorf("failed to parse address and location from export location '%s'", args.Location)
+	server, path, err := parseNFSLocation(args.Location)
+	if err != nil {
+		return &v1.PersistentVolumeSource{}, err
 	}
 
-	server := args.Location[:delimPos]
-	path := args.Location[delimPos+1:]
-
 	return &v1.PersistentVolumeSource{
 		NFS: &v1.NFSVolumeSource{
 			Server:   server,
 			Path:     path,
-			ReadOnly: false,
+			ReadOnly: args.ReadOnly,
 		},
 	}, nil
 }
+
+// BuildMountOptions merges the mount options with the defaults of NFS
+func (b *NFSBackend) BuildMountOptions(args *BuildSourceArgs) ([]string, error) {
+	options, err := splitMountOptions(args.MountOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range options {
+		if err := validateNFSMountOption(o); err != nil {
+			return nil, err
+		}
+	}
+	return mergeMountOptions(nfsDefaultMountOptions, options), nil
+}
+
+// validateNFSMountOption rejects the options with an invalid value
+func validateNFSMountOption(option string) error {
+	parts := strings.SplitN(option, "=", 2)
+	key := parts[0]
+	if key == "" {
+		return fmt.Errorf("invalid mount option %q", option)
+	}
+	if len(parts) == 1 {
+		if nfsNumericMountOptions[key] || nfsEnumMountOptions[key] != nil {
+			return fmt.Errorf("mount option %q requires a value", option)
+		}
+		return nil
+	}
+
+	value := parts[1]
+	if nfsNumericMountOptions[key] {
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("mount option %q requires a non-negative integer", option)
+		}
+	}
+	if values, ok := nfsEnumMountOptions[key]; ok {
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("mount option %q requires one of %s", option, strings.Join(values, ", "))
+	}
+	return nil
+}
+
+// BuildAccess returns no access rules, NFS shares are only accessed from the vpc
+func (b *NFSBackend) BuildAccess(args *BuildSourceArgs) ([]Access, error) {
+	return nil, nil
+}
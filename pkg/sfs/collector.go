@@ -0,0 +1,148 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// ShareCollector periodically looks for the shares tagged with the cluster id which are not
+// referenced by a persistent volume. Orphans are reported, and deleted once they are orphaned
+// for the grace period if deletion is enabled.
+type ShareCollector struct {
+	provisioner *Provisioner
+	gracePeriod time.Duration
+	delete      bool
+	dryRun      bool
+
+	// orphans records when the orphans were found first
+	orphans map[string]time.Time
+}
+
+// NewShareCollector creates a new share collector for the sfs provisioner
+func NewShareCollector(p *Provisioner, gracePeriod time.Duration, delete, dryRun bool) *ShareCollector {
+	return &ShareCollector{
+		provisioner: p,
+		gracePeriod: gracePeriod,
+		delete:      delete,
+		dryRun:      dryRun,
+		orphans:     map[string]time.Time{},
+	}
+}
+
+// Run collects the orphans every period until the stop channel is closed
+func (c *ShareCollector) Run(period time.Duration, stopCh <-chan struct{}) {
+	if c.provisioner.clusterID == "" {
+		glog.Warning("Share collector is disabled, the cluster id is not set")
+		return
+	}
+	glog.Infof("Starting share collector, period: %v grace period: %v delete: %v dry run: %v",
+		period, c.gracePeriod, c.delete, c.dryRun)
+	wait.Until(func() {
+		if err := c.collect(time.Now()); err != nil {
+			glog.Errorf("Failed to collect orphaned shares: %v", err)
+		}
+	}, period, stopCh)
+}
+
+// collect reports the orphans and deletes the ones orphaned for the grace period
+func (c *ShareCollector) collect(now time.Time) error {
+	client, err := c.provisioner.cloudconfig.Get().SFSV2Client()
+	if err != nil {
+		return fmt.Errorf("Failed to create SFS v2 client: %v", err)
+	}
+	list, err := ListShares(client, shares.ListOpts{})
+	if err != nil {
+		return fmt.Errorf("Failed to list shares: %v", err)
+	}
+
+	// list the volumes after the shares, so that a share created meanwhile is referenced
+	referenced, err := ReferencedShares(c.provisioner.clientset)
+	if err != nil {
+		return err
+	}
+
+	found := map[string]time.Time{}
+	for _, share := range list {
+		if share.Metadata[SFSMetadataClusterID] != c.provisioner.clusterID || referenced[share.ID] {
+			continue
+		}
+		// shares of the recycle bin are deleted after the retention
+		if share.Metadata[SFSMetadataRecycledAt] != "" {
+			continue
+		}
+		// shares of provisions in flight have no volume yet
+		inFlight := time.Duration(c.provisioner.sharetimeout) * time.Second
+		if now.Sub(share.CreatedAt) < inFlight || share.Status == "deleting" {
+			continue
+		}
+
+		since, ok := c.orphans[share.ID]
+		if !ok {
+			since = now
+		}
+		found[share.ID] = since
+		glog.Warningf("Share %s (%s) of cluster %s is orphaned since %v", share.ID, share.Name, c.provisioner.clusterID, since)
+
+		if !c.delete || now.Sub(since) < c.gracePeriod {
+			continue
+		}
+		if c.dryRun {
+			glog.Infof("Dry run: would delete orphaned share %s (%s)", share.ID, share.Name)
+			continue
+		}
+		glog.Infof("Delete orphaned share %s (%s)", share.ID, share.Name)
+		if err := DeleteShare(client, share.ID); err != nil {
+			orphanShareDeleteErrorsTotal.Inc()
+			glog.Errorf("Failed to delete orphaned share %s: %v", share.ID, err)
+			continue
+		}
+		orphanSharesDeletedTotal.Inc()
+		delete(found, share.ID)
+	}
+
+	c.orphans = found
+	orphanShares.Set(float64(len(found)))
+	return nil
+}
+
+// ReferencedShares returns the ids of the shares of the persistent volumes
+func ReferencedShares(c clientset.Interface) (map[string]bool, error) {
+	pvs, err := c.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list persistent volumes: %v", err)
+	}
+
+	referenced := map[string]bool{}
+	for _, pv := range pvs.Items {
+		if id := pv.Annotations[SFSAnnotationID]; id != "" {
+			referenced[id] = true
+		}
+		// the volume handle of the csi plugin is the share id
+		if pv.Spec.CSI != nil {
+			referenced[pv.Spec.CSI.VolumeHandle] = true
+		}
+	}
+	return referenced, nil
+}
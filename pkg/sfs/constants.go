@@ -18,12 +18,67 @@ package sfs
 
 // Defines constants
 const (
-	SFSStatusAvailable = "available"
-	SFSAnnotationID    = "external.k8s.io/sfs-id"
+	SFSStatusAvailable      = "available"
+	SFSStatusError          = "error"
+	SFSStatusErrorDeleting  = "error_deleting"
+	SFSStatusExtendingError = "extending_error"
+	SFSStatusShrinkingError = "shrinking_error"
+	SFSAnnotationID         = "external.k8s.io/sfs-id"
+
+	SFSAccessStateActive  = "active"
+	SFSAccessStateError   = "error"
+	SFSAccessStateDenying = "denying"
+
+	SFSMetadataClusterID               = "external.k8s.io/cluster-id"
+	SFSMetadataRecycledAt              = "external.k8s.io/recycled-at"
+	SFSMetadataRecycledPVCNamespace    = "external.k8s.io/recycled-pvc-namespace"
+	SFSMetadataRecycledPVCName         = "external.k8s.io/recycled-pvc-name"
+	SFSMetadataRecycledPV              = "external.k8s.io/recycled-pv"
+	SFSMetadataRecycledSecretNamespace = "external.k8s.io/recycled-secret-namespace"
+	SFSMetadataRecycledSecretName      = "external.k8s.io/recycled-secret-name"
+
+	SFSAnnotationSecretName      = "external.k8s.io/sfs-secret-name"
+	SFSAnnotationSecretNamespace = "external.k8s.io/sfs-secret-namespace"
+	SFSAnnotationRestoreShare    = "external.k8s.io/sfs-restore-share"
+	SFSAnnotationAdoptShare      = "external.k8s.io/sfs-adopt-share"
+	SFSAnnotationAdopted         = "external.k8s.io/sfs-adopted"
+	SFSAnnotationKeepShare       = "external.k8s.io/sfs-keep-share"
+	SFSAnnotationGrantedAccess   = "external.k8s.io/sfs-granted-access"
+
+	SFSEventVolumeResizeFailed          = "VolumeResizeFailed"
+	SFSEventVolumeResizeSuccessful      = "VolumeResizeSuccessful"
+	SFSEventProvisioningRolledBack      = "ProvisioningRolledBack"
+	SFSEventProvisioningRollbackSkipped = "ProvisioningRollbackSkipped"
+	SFSEventShareFailed                 = "ShareFailed"
+	SFSEventShareDeletionFailed         = "ShareDeletionFailed"
+	SFSEventInvalidMountOptions         = "InvalidMountOptions"
+	SFSEventAccessRuleDrift             = "AccessRuleDrift"
+	SFSEventAccessRuleRepaired          = "AccessRuleRepaired"
+	SFSEventVPCNotFound                 = "VPCNotFound"
+	SFSEventShareRecycled               = "ShareRecycled"
+	SFSEventShareRecycleFailed          = "ShareRecycleFailed"
+	SFSEventShareRestored               = "ShareRestored"
+	SFSEventShareAdopted                = "ShareAdopted"
+	SFSEventShareReleased               = "ShareReleased"
 
 	SFSParametersAvailability    = "availability"
 	SFSParametersVPCID           = "vpcid"
 	SFSParametersProtocol        = "protocol"
 	SFSParametersProtocolDefault = "NFS"
 	SFSParametersType            = "type"
+	SFSParametersSecretName      = "secretName"
+	SFSParametersSecretNamespace = "secretNamespace"
+	SFSParametersBackend         = "backend"
+	SFSParametersLocationPolicy  = "locationPolicy"
+	SFSParametersLocationSubnet  = "locationSubnet"
+	SFSParametersAccessRules     = "accessRules"
+	SFSParametersReadOnly        = "readOnly"
+	SFSParametersDeleteAdopted   = "deleteAdoptedShare"
+)
+
+// Defines the export location policies
+const (
+	SFSLocationPolicyPreferred = "Preferred"
+	SFSLocationPolicyDNS       = "DNS"
+	SFSLocationPolicyIP        = "IP"
 )
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// secretRef references the secret of a credential set
+type secretRef struct {
+	namespace string
+	name      string
+}
+
+// credentialsCache caches the credentials of secrets by namespace and name. An entry is
+// replaced when the resource version of its secret changes and dropped when the secret
+// is deleted, so that the cache holds at most one entry per existing secret.
+type credentialsCache struct {
+	mu      sync.Mutex
+	entries map[secretRef]credentialsEntry
+}
+
+// credentialsEntry is the credentials of a version of a secret
+type credentialsEntry struct {
+	resourceVersion string
+	cc              *config.CloudCredentials
+}
+
+// newCredentialsCache creates an empty cache
+func newCredentialsCache() *credentialsCache {
+	return &credentialsCache{entries: map[secretRef]credentialsEntry{}}
+}
+
+// get the credentials of the secret, loading them if the secret changed
+func (c *credentialsCache) get(client clientset.Interface, ref secretRef) (*config.CloudCredentials, error) {
+	secret, err := client.CoreV1().Secrets(ref.namespace).Get(ref.name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			c.mu.Lock()
+			delete(c.entries, ref)
+			c.mu.Unlock()
+		}
+		return nil, fmt.Errorf("Failed to get secret %s/%s: %v", ref.namespace, ref.name, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[ref]; ok && entry.resourceVersion == secret.ResourceVersion {
+		return entry.cc, nil
+	}
+
+	data, ok := secret.Data[config.CloudConfigSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("Secret %s/%s has no key %s", ref.namespace, ref.name, config.CloudConfigSecretKey)
+	}
+	cc, err := config.LoadConfigFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load cloud config of secret %s/%s: %v", ref.namespace, ref.name, err)
+	}
+	c.entries[ref] = credentialsEntry{resourceVersion: secret.ResourceVersion, cc: &cc}
+	return &cc, nil
+}
+
+// classCredentials returns the credentials referenced by the storage class parameters and
+// the reference of their secret, or the global credentials and nil if there is no reference.
+func (p *Provisioner) classCredentials(parameters map[string]string, pvc *v1.PersistentVolumeClaim) (*config.CloudCredentials, *secretRef, error) {
+	name := parameters[SFSParametersSecretName]
+	namespace := parameters[SFSParametersSecretNamespace]
+	if name == "" && namespace == "" {
+		return p.cloudconfig.Get(), nil, nil
+	}
+	if name == "" || namespace == "" {
+		return nil, nil, fmt.Errorf("Both %s and %s must be set", SFSParametersSecretName, SFSParametersSecretNamespace)
+	}
+
+	ref := secretRef{}
+	var err error
+	if ref.name, err = resolveSecretTemplate(name, pvc); err != nil {
+		return nil, nil, err
+	}
+	if ref.namespace, err = resolveSecretTemplate(namespace, pvc); err != nil {
+		return nil, nil, err
+	}
+
+	cc, err := p.credentials.get(p.clientset, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cc, &ref, nil
+}
+
+// volumeCredentials returns the credentials recorded in the persistent volume, or the global ones
+func (p *Provisioner) volumeCredentials(pv *v1.PersistentVolume) (*config.CloudCredentials, error) {
+	name := pv.Annotations[SFSAnnotationSecretName]
+	namespace := pv.Annotations[SFSAnnotationSecretNamespace]
+	if name == "" || namespace == "" {
+		return p.cloudconfig.Get(), nil
+	}
+	return p.credentials.get(p.clientset, secretRef{namespace: namespace, name: name})
+}
+
+// resolveSecretTemplate replaces the claim placeholders of a secret parameter
+func resolveSecretTemplate(template string, pvc *v1.PersistentVolumeClaim) (string, error) {
+	resolved := strings.NewReplacer(
+		"${pvc.namespace}", pvc.Namespace,
+		"${pvc.name}", pvc.Name,
+	).Replace(template)
+	if strings.Contains(resolved, "${") {
+		return "", fmt.Errorf("Unsupported placeholder in secret parameter %s", template)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newCredentialsSecret returns a secret holding AK/SK credentials of the region
+func newCredentialsSecret(name, resourceVersion, region string) *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: name, ResourceVersion: resourceVersion},
+		Data: map[string][]byte{
+			config.CloudConfigSecretKey: []byte(fmt.Sprintf(
+				"[Global]\nauth-url = https://iam.example.com/v3\naccess-key = ak\nsecret-key = sk\nproject-id = project\nregion = %s\n",
+				region)),
+		},
+	}
+}
+
+func TestCredentialsCache(t *testing.T) {
+	api := fake.NewAPIServer(newCredentialsSecret("secret-1", "1", "region-1"))
+	defer api.Close()
+	client := api.Clientset()
+	cache := newCredentialsCache()
+	ref := secretRef{namespace: "tenant", name: "secret-1"}
+
+	first, err := cache.get(client, ref)
+	if err != nil {
+		t.Fatalf("Failed to get credentials: %v", err)
+	}
+	cached, err := cache.get(client, ref)
+	if err != nil || cached != first {
+		t.Errorf("Expected the cached credentials of an unchanged secret, got %v", err)
+	}
+
+	// a new resource version replaces the entry of the secret
+	if _, err := client.CoreV1().Secrets("tenant").Update(newCredentialsSecret("secret-1", "2", "region-2")); err != nil {
+		t.Fatalf("Failed to update secret: %v", err)
+	}
+	updated, err := cache.get(client, ref)
+	if err != nil {
+		t.Fatalf("Failed to get updated credentials: %v", err)
+	}
+	if updated == first || updated.Global.Region != "region-2" {
+		t.Errorf("Expected the credentials of the updated secret, got region %s", updated.Global.Region)
+	}
+
+	// the entry of a deleted secret is dropped
+	deleted := secretRef{namespace: "tenant", name: "deleted"}
+	cache.entries[deleted] = credentialsEntry{resourceVersion: "1", cc: first}
+	if _, err := cache.get(client, deleted); err == nil {
+		t.Errorf("Expected an error for a deleted secret")
+	}
+
+	if len(cache.entries) != 1 || cache.entries[ref].resourceVersion != "2" {
+		t.Errorf("Expected a single entry of the current secret version, got %+v", cache.entries)
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// APIServer is a kubernetes api serving and updating the objects it was created with,
+// the client-go fake clientset is not vendored.
+type APIServer struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	objects map[string][]runtime.Object
+}
+
+// NewAPIServer starts an api server serving the objects, it must be closed after the test.
+// Nodes, persistent volumes, claims, secrets and storage classes are supported.
+func NewAPIServer(objects ...runtime.Object) *APIServer {
+	s := &APIServer{objects: map[string][]runtime.Object{}}
+	for _, obj := range objects {
+		s.Add(obj)
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close stops the api server
+func (s *APIServer) Close() {
+	s.server.Close()
+}
+
+// Clientset returns a clientset of the api server
+func (s *APIServer) Clientset() clientset.Interface {
+	return clientset.NewForConfigOrDie(&rest.Config{Host: s.server.URL})
+}
+
+// Add adds an object to the api server
+func (s *APIServer) Add(obj runtime.Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	apiVersion, resource := typeOf(obj)
+	obj.GetObjectKind().SetGroupVersionKind(schema.FromAPIVersionAndKind(apiVersion, resourceKinds[resource]))
+	s.objects[resource] = append(s.objects[resource], obj)
+}
+
+// resourceKinds are the kinds of the supported resources
+var resourceKinds = map[string]string{
+	"nodes":                  "Node",
+	"persistentvolumes":      "PersistentVolume",
+	"persistentvolumeclaims": "PersistentVolumeClaim",
+	"secrets":                "Secret",
+	"storageclasses":         "StorageClass",
+}
+
+// typeOf returns the api version and resource of the object
+func typeOf(obj runtime.Object) (string, string) {
+	switch obj.(type) {
+	case *v1.Node:
+		return "v1", "nodes"
+	case *v1.PersistentVolume:
+		return "v1", "persistentvolumes"
+	case *v1.PersistentVolumeClaim:
+		return "v1", "persistentvolumeclaims"
+	case *v1.Secret:
+		return "v1", "secrets"
+	case *storagev1.StorageClass:
+		return "storage.k8s.io/v1", "storageclasses"
+	}
+	panic(fmt.Sprintf("unsupported object %T", obj))
+}
+
+func (s *APIServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, fmt.Sprintf("unexpected request %s %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// /api/v1/[namespaces/<namespace>/]<resource>[/<name>] or /apis/<group>/<version>/...
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+	apiVersion := "v1"
+	if path == r.URL.Path {
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/apis/"), "/", 3)
+		if len(parts) < 3 {
+			http.NotFound(w, r)
+			return
+		}
+		apiVersion = parts[0] + "/" + parts[1]
+		path = parts[2]
+	}
+	parts := strings.Split(path, "/")
+	namespace := ""
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		namespace = parts[1]
+		parts = parts[2:]
+	}
+
+	kind, ok := resourceKinds[parts[0]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var items []runtime.Object
+	for i, obj := range s.objects[parts[0]] {
+		accessor, _ := meta.Accessor(obj)
+		if namespace != "" && accessor.GetNamespace() != namespace {
+			continue
+		}
+		if len(parts) > 1 {
+			if accessor.GetName() == parts[1] {
+				if r.Method == http.MethodPut {
+					obj = s.update(w, r, obj)
+					if obj == nil {
+						return
+					}
+					s.objects[parts[0]][i] = obj
+				}
+				writeJSON(w, http.StatusOK, obj)
+				return
+			}
+			continue
+		}
+		items = append(items, obj)
+	}
+	if len(parts) > 1 {
+		writeJSON(w, http.StatusNotFound, &metav1.Status{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+			Status:   metav1.StatusFailure,
+			Reason:   metav1.StatusReasonNotFound,
+			Code:     http.StatusNotFound,
+			Message:  fmt.Sprintf("%s %s not found", parts[0], parts[1]),
+		})
+		return
+	}
+
+	if items == nil {
+		items = []runtime.Object{}
+	}
+	body := map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind + "List",
+		"metadata":   map[string]string{},
+		"items":      items,
+	}
+	b, _ := json.Marshal(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+// update replaces the object by the one in the request body of an update or a status update,
+// it answers the request and returns nil if the body is invalid
+func (s *APIServer) update(w http.ResponseWriter, r *http.Request, obj runtime.Object) runtime.Object {
+	updated := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+	if err := json.NewDecoder(r.Body).Decode(updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	updated.GetObjectKind().SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+	return updated
+}
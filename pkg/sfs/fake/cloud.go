@@ -0,0 +1,475 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake implements an in-memory SFS endpoint for tests.
+// It serves the share requests of the golangsdk shares package.
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+)
+
+// ProjectID is the project of the fake cloud
+const ProjectID = "project"
+
+// Share is a share of the fake cloud
+type Share struct {
+	shares.Share
+	StatusDetail string
+	Access       []shares.AccessRight
+}
+
+// Snapshot is a share snapshot of the fake cloud, snapshots are created available
+type Snapshot struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	ShareID    string `json:"share_id"`
+	ShareProto string `json:"share_proto"`
+	ShareSize  int    `json:"share_size"`
+	Status     string `json:"status"`
+}
+
+// Cloud is a fake SFS endpoint, the fields configure the behaviour of the requests
+type Cloud struct {
+	// CreateStatus is the status of created shares, available if empty
+	CreateStatus string
+	// ListError is the status code answering list requests if not zero
+	ListError int
+	// AccessState is the state of granted access rules, active if empty
+	AccessState string
+	// GrantError is the status code answering grant requests if not zero
+	GrantError int
+	// ExtendStatus is the status of extended shares, they keep their status if empty
+	ExtendStatus string
+	// DeleteStatus is the status of deleted shares, they disappear if empty
+	DeleteStatus string
+	// ForceDeleteStatus is the status of force deleted shares, they disappear if empty
+	ForceDeleteStatus string
+	// ForceDeleteError is the status code answering force delete requests if not zero
+	ForceDeleteError int
+	// DenyPolls is the number of access lists which still report a denied rule as denying
+	DenyPolls int
+
+	server    *httptest.Server
+	mu        sync.Mutex
+	shares    map[string]*Share
+	snapshots map[string]*Snapshot
+	denied    map[string]int
+	calls     map[string]int
+	nextID    int
+}
+
+// NewCloud starts a fake cloud, it must be closed after the test
+func NewCloud() *Cloud {
+	c := &Cloud{
+		shares:    map[string]*Share{},
+		snapshots: map[string]*Snapshot{},
+		denied:    map[string]int{},
+		calls:     map[string]int{},
+	}
+	c.server = httptest.NewServer(http.HandlerFunc(c.serveHTTP))
+	return c
+}
+
+// Close stops the fake cloud
+func (c *Cloud) Close() {
+	c.server.Close()
+}
+
+// Credentials returns the cloud credentials whose clients send the requests to the fake cloud
+func (c *Cloud) Credentials() *config.CloudCredentials {
+	target, _ := url.Parse(c.server.URL)
+	cc := &config.CloudCredentials{}
+	cc.Global.AccessKey = "ak"
+	cc.Global.SecretKey = "sk"
+	cc.Global.Region = "region"
+	cc.Global.Cloud = "fake.cloud"
+	cc.CloudClient = &golangsdk.ProviderClient{
+		ProjectID: ProjectID,
+		HTTPClient: http.Client{
+			Transport: &rewriteTransport{target: target},
+		},
+	}
+	return cc
+}
+
+// AddShare adds a share to the fake cloud
+func (c *Cloud) AddShare(share *Share) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shares[share.ID] = share
+}
+
+// GetShare returns a copy of the share, nil if it does not exist
+func (c *Cloud) GetShare(id string) *Share {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	share, ok := c.shares[id]
+	if !ok {
+		return nil
+	}
+	s := *share
+	s.Access = append([]shares.AccessRight(nil), share.Access...)
+	return &s
+}
+
+// Shares returns the ids of the shares
+func (c *Cloud) Shares() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ids []string
+	for id := range c.shares {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Snapshots returns the ids of the snapshots
+func (c *Cloud) Snapshots() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ids []string
+	for id := range c.snapshots {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Calls returns the number of the requests of the operation,
+// e.g. create, get, list, delete, export_locations, the name of a share action or
+// snapshot_create, snapshot_get, snapshot_list and snapshot_delete
+func (c *Cloud) Calls(operation string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[operation]
+}
+
+// rewriteTransport sends the requests to the fake cloud
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	r := request.WithContext(request.Context())
+	u := *request.URL
+	u.Scheme = t.target.Scheme
+	u.Host = t.target.Host
+	r.URL = &u
+	r.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (c *Cloud) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/v2/"+ProjectID+"/snapshots") {
+		c.serveSnapshots(w, r)
+		return
+	}
+	prefix := "/v2/" + ProjectID + "/shares"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+
+	switch {
+	case parts[0] == "" && r.Method == http.MethodPost:
+		c.calls["create"]++
+		c.createShare(w, r)
+	case parts[0] == "detail" && r.Method == http.MethodGet:
+		c.calls["list"]++
+		if c.ListError != 0 {
+			http.Error(w, "list shares failed", c.ListError)
+			return
+		}
+		c.listShares(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		c.calls["get"]++
+		if share := c.lookup(w, parts[0]); share != nil {
+			writeJSON(w, http.StatusOK, c.shareBody(share))
+		}
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		c.calls["delete"]++
+		if share := c.lookup(w, parts[0]); share != nil {
+			c.deleteShare(share, c.DeleteStatus)
+			w.WriteHeader(http.StatusAccepted)
+		}
+	case len(parts) == 2 && parts[1] == "export_locations" && r.Method == http.MethodGet:
+		c.calls["export_locations"]++
+		if share := c.lookup(w, parts[0]); share != nil {
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"export_locations": []shares.ExportLocation{{Path: share.ExportLocation, Preferred: true}},
+			})
+		}
+	case len(parts) == 2 && parts[1] == "action" && r.Method == http.MethodPost:
+		if share := c.lookup(w, parts[0]); share != nil {
+			c.shareAction(w, r, share)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unexpected request %s %s", r.Method, r.URL.Path), http.StatusBadRequest)
+	}
+}
+
+// serveSnapshots serves the snapshot requests, the calls are counted as snapshot_<operation>
+func (c *Cloud) serveSnapshots(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v2/"+ProjectID+"/snapshots"), "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		c.calls["snapshot_create"]++
+		var body struct {
+			Snapshot struct {
+				ShareID string `json:"share_id"`
+				Name    string `json:"name"`
+			} `json:"snapshot"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		share := c.lookup(w, body.Snapshot.ShareID)
+		if share == nil {
+			return
+		}
+		c.nextID++
+		snapshot := &Snapshot{
+			ID:         fmt.Sprintf("snapshot-%d", c.nextID),
+			Name:       body.Snapshot.Name,
+			ShareID:    share.ID,
+			ShareProto: share.ShareProto,
+			ShareSize:  share.Size,
+			Status:     "available",
+		}
+		c.snapshots[snapshot.ID] = snapshot
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"snapshot": snapshot})
+	case id == "detail" && r.Method == http.MethodGet:
+		c.calls["snapshot_list"]++
+		name := r.URL.Query().Get("name")
+		list := []*Snapshot{}
+		for _, snapshot := range c.snapshots {
+			if name == "" || snapshot.Name == name {
+				list = append(list, snapshot)
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"snapshots": list})
+	case r.Method == http.MethodGet:
+		c.calls["snapshot_get"]++
+		if snapshot, ok := c.snapshots[id]; ok {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"snapshot": snapshot})
+			return
+		}
+		http.Error(w, fmt.Sprintf("snapshot %s not found", id), http.StatusNotFound)
+	case r.Method == http.MethodDelete:
+		c.calls["snapshot_delete"]++
+		if _, ok := c.snapshots[id]; ok {
+			delete(c.snapshots, id)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		http.Error(w, fmt.Sprintf("snapshot %s not found", id), http.StatusNotFound)
+	default:
+		http.Error(w, fmt.Sprintf("unexpected request %s %s", r.Method, r.URL.Path), http.StatusBadRequest)
+	}
+}
+
+// lookup returns the share or answers not found
+func (c *Cloud) lookup(w http.ResponseWriter, id string) *Share {
+	share, ok := c.shares[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("share %s not found", id), http.StatusNotFound)
+		return nil
+	}
+	return share
+}
+
+func (c *Cloud) createShare(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Share struct {
+			Name             string            `json:"name"`
+			ShareProto       string            `json:"share_proto"`
+			Size             int               `json:"size"`
+			AvailabilityZone string            `json:"availability_zone"`
+			SnapshotID       string            `json:"snapshot_id"`
+			Metadata         map[string]string `json:"metadata"`
+		} `json:"share"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.nextID++
+	id := fmt.Sprintf("share-%d", c.nextID)
+	status := c.CreateStatus
+	if status == "" {
+		status = "available"
+	}
+	share := &Share{Share: shares.Share{
+		ID:               id,
+		Name:             body.Share.Name,
+		ShareProto:       body.Share.ShareProto,
+		Size:             body.Share.Size,
+		AvailabilityZone: body.Share.AvailabilityZone,
+		SnapshotID:       body.Share.SnapshotID,
+		Metadata:         body.Share.Metadata,
+		Status:           status,
+		ExportLocation:   fmt.Sprintf("192.168.0.10:/%s", id),
+	}}
+	c.shares[id] = share
+	writeJSON(w, http.StatusOK, c.shareBody(share))
+}
+
+func (c *Cloud) listShares(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	list := []shares.Share{}
+	for _, share := range c.shares {
+		if name == "" || share.Name == name {
+			list = append(list, share.Share)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"shares": list})
+}
+
+func (c *Cloud) shareAction(w http.ResponseWriter, r *http.Request, share *Share) {
+	var body map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for action, args := range body {
+		c.calls[action]++
+		switch action {
+		case "os-access_list":
+			c.listAccess(w, share)
+		case "os-allow_access":
+			c.allowAccess(w, share, args)
+		case "os-deny_access":
+			c.denyAccess(w, share, args)
+		case "os-extend":
+			var extend struct {
+				NewSize int `json:"new_size"`
+			}
+			json.Unmarshal(args, &extend)
+			share.Size = extend.NewSize
+			if c.ExtendStatus != "" {
+				share.Status = c.ExtendStatus
+			}
+			w.WriteHeader(http.StatusAccepted)
+		case "os-force_delete":
+			if c.ForceDeleteError != 0 {
+				http.Error(w, "force delete failed", c.ForceDeleteError)
+				return
+			}
+			c.deleteShare(share, c.ForceDeleteStatus)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.Error(w, fmt.Sprintf("unexpected action %s", action), http.StatusBadRequest)
+		}
+		return
+	}
+	http.Error(w, "missing action", http.StatusBadRequest)
+}
+
+func (c *Cloud) listAccess(w http.ResponseWriter, share *Share) {
+	var rights []shares.AccessRight
+	for _, right := range share.Access {
+		if right.State == "denying" {
+			if c.denied[right.ID] >= c.DenyPolls {
+				continue
+			}
+			c.denied[right.ID]++
+		}
+		rights = append(rights, right)
+	}
+	share.Access = rights
+	writeJSON(w, http.StatusOK, map[string]interface{}{"access_list": rights})
+}
+
+func (c *Cloud) allowAccess(w http.ResponseWriter, share *Share, args json.RawMessage) {
+	if c.GrantError != 0 {
+		http.Error(w, "grant access failed", c.GrantError)
+		return
+	}
+	var opts shares.GrantAccessOpts
+	if err := json.Unmarshal(args, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	state := c.AccessState
+	if state == "" {
+		state = "active"
+	}
+	c.nextID++
+	right := shares.AccessRight{
+		ID:          fmt.Sprintf("access-%d", c.nextID),
+		AccessType:  opts.AccessType,
+		AccessTo:    opts.AccessTo,
+		AccessLevel: opts.AccessLevel,
+		State:       state,
+	}
+	share.Access = append(share.Access, right)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"access": right})
+}
+
+func (c *Cloud) denyAccess(w http.ResponseWriter, share *Share, args json.RawMessage) {
+	var opts shares.DeleteAccessOpts
+	if err := json.Unmarshal(args, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i := range share.Access {
+		if share.Access[i].ID == opts.AccessID {
+			share.Access[i].State = "denying"
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("access rule %s not found", opts.AccessID), http.StatusNotFound)
+}
+
+// deleteShare removes the share or leaves it in the status
+func (c *Cloud) deleteShare(share *Share, status string) {
+	if status == "" {
+		delete(c.shares, share.ID)
+		return
+	}
+	share.Status = status
+}
+
+func (c *Cloud) shareBody(share *Share) map[string]interface{} {
+	b, _ := json.Marshal(share.Share)
+	var body map[string]interface{}
+	json.Unmarshal(b, &body)
+	body["status_detail"] = share.StatusDetail
+	return map[string]interface{}{"share": body}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
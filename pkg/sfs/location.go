@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+)
+
+// GetShareLocations returns the export locations of share usable by end users,
+// the preferred ones first. The locations of the share are used if the export
+// locations can not be listed.
+func GetShareLocations(client *golangsdk.ServiceClient, share *shares.Share) ([]string, error) {
+	var locations []string
+	exports, err := shares.GetExportLocations(client, share.ID).ExtractExportLocations()
+	if err != nil {
+		glog.Warningf("Failed to list export locations of share %s, use the share locations: %v", share.ID, err)
+	}
+	sort.SliceStable(exports, func(i, j int) bool {
+		return exports[i].Preferred && !exports[j].Preferred
+	})
+	for _, e := range exports {
+		if !e.IsAdminOnly && e.Path != "" {
+			locations = append(locations, e.Path)
+		}
+	}
+
+	if len(locations) == 0 {
+		if share.ExportLocation != "" {
+			locations = append(locations, share.ExportLocation)
+		}
+		for _, l := range share.ExportLocations {
+			if l != "" && l != share.ExportLocation {
+				locations = append(locations, l)
+			}
+		}
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("Failed to get share %s location", share.ID)
+	}
+	return locations, nil
+}
+
+// SelectShareLocation returns the export location of share chosen by the location policy
+// and subnet parameters. Locations in the subnet are chosen first, then the ones of the policy.
+func SelectShareLocation(client *golangsdk.ServiceClient, share *shares.Share, parameters map[string]string) (string, error) {
+	if err := ValidateLocationParameters(parameters); err != nil {
+		return "", err
+	}
+	locations, err := GetShareLocations(client, share)
+	if err != nil {
+		return "", err
+	}
+
+	// skip the locations which can not be parsed
+	var candidates []string
+	hosts := map[string]string{}
+	for _, l := range locations {
+		host, err := backends.LocationHost(l)
+		if err != nil {
+			glog.Warningf("Skip export location of share %s: %v", share.ID, err)
+			continue
+		}
+		candidates = append(candidates, l)
+		hosts[l] = host
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("Share %s has no valid export location in %v", share.ID, locations)
+	}
+
+	// keep the locations in the subnet
+	if subnet := parameters[SFSParametersLocationSubnet]; subnet != "" {
+		_, ipnet, _ := net.ParseCIDR(subnet)
+		var inSubnet []string
+		for _, l := range candidates {
+			if ip := net.ParseIP(hosts[l]); ip != nil && ipnet.Contains(ip) {
+				inSubnet = append(inSubnet, l)
+			}
+		}
+		if len(inSubnet) == 0 {
+			return "", fmt.Errorf("Share %s has no export location in subnet %s: %v", share.ID, subnet, candidates)
+		}
+		candidates = inSubnet
+	}
+
+	// prefer the locations of the policy
+	policy := parameters[SFSParametersLocationPolicy]
+	for _, l := range candidates {
+		isIP := net.ParseIP(hosts[l]) != nil
+		if (policy == SFSLocationPolicyDNS && !isIP) || (policy == SFSLocationPolicyIP && isIP) {
+			return l, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// ValidateLocationParameters checks the location policy and subnet parameters
+func ValidateLocationParameters(parameters map[string]string) error {
+	switch policy := parameters[SFSParametersLocationPolicy]; policy {
+	case "", SFSLocationPolicyPreferred, SFSLocationPolicyDNS, SFSLocationPolicyIP:
+	default:
+		return fmt.Errorf("Unsupported %s %s, must be %s, %s or %s", SFSParametersLocationPolicy, policy,
+			SFSLocationPolicyPreferred, SFSLocationPolicyDNS, SFSLocationPolicyIP)
+	}
+	if subnet := parameters[SFSParametersLocationSubnet]; subnet != "" {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			return fmt.Errorf("Invalid %s %s: %v", SFSParametersLocationSubnet, subnet, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsSubsystem is the prometheus subsystem of the sfs metrics
+const metricsSubsystem = "sfs"
+
+// Defines the phases and operations of the metrics
+const (
+	phaseCreate = "create"
+	phaseWait   = "wait"
+	phaseGrant  = "grant"
+	phaseDelete = "delete"
+
+	operationProvision = "provision"
+	operationDelete    = "delete"
+)
+
+var (
+	// accessRuleDriftTotal counts the access rules differing from the declared ones
+	accessRuleDriftTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "access_rule_drift_total",
+			Help:      "Total number of access rules differing from the declared ones. Broken down by kind of drift and whether it was repaired.",
+		},
+		[]string{"kind", "repaired"},
+	)
+	// accessReconcileErrorsTotal counts the failed reconciles of the access rules of a volume
+	accessReconcileErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "access_reconcile_errors_total",
+			Help:      "Total number of failed reconciles of the access rules of a persistent volume.",
+		},
+	)
+	// orphanShares is the number of shares of the cluster not referenced by a persistent volume
+	orphanShares = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "orphan_shares",
+			Help:      "Number of shares of the cluster not referenced by a persistent volume.",
+		},
+	)
+	// orphanSharesDeletedTotal counts the deleted orphans
+	orphanSharesDeletedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "orphan_shares_deleted_total",
+			Help:      "Total number of deleted shares of the cluster not referenced by a persistent volume.",
+		},
+	)
+	// orphanShareDeleteErrorsTotal counts the failed deletes of orphans
+	orphanShareDeleteErrorsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "orphan_share_delete_errors_total",
+			Help:      "Total number of failed deletes of shares of the cluster not referenced by a persistent volume.",
+		},
+	)
+	// recycledShares is the number of shares in the recycle bin
+	recycledShares = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "recycled_shares",
+			Help:      "Number of shares in the recycle bin.",
+		},
+	)
+	// recycledSharesDeletedTotal counts the shares deleted from the recycle bin
+	recycledSharesDeletedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "recycled_shares_deleted_total",
+			Help:      "Total number of shares deleted from the recycle bin after the retention.",
+		},
+	)
+	// phaseDuration observes the durations of the phases of the share operations
+	phaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "phase_duration_seconds",
+			Help:      "Duration of the phases of provisioning and deleting shares. Broken down by phase and result.",
+			Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+		},
+		[]string{"phase", "result"},
+	)
+	// operationsInFlight is the number of running share operations
+	operationsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Subsystem: metricsSubsystem,
+			Name:      "operations_in_flight",
+			Help:      "Number of running provisions and deletes of shares. Broken down by operation.",
+		},
+		[]string{"operation"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(
+		accessRuleDriftTotal,
+		accessReconcileErrorsTotal,
+		orphanShares,
+		orphanSharesDeletedTotal,
+		orphanShareDeleteErrorsTotal,
+		recycledShares,
+		recycledSharesDeletedTotal,
+		phaseDuration,
+		operationsInFlight,
+	)
+}
+
+// observePhase records the duration and the result of a phase started at start
+func observePhase(phase string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	phaseDuration.WithLabelValues(phase, result).Observe(time.Since(start).Seconds())
+}
+
+// trackOperation counts the operation as in flight until the returned func is called
+func trackOperation(operation string) func() {
+	gauge := operationsInFlight.WithLabelValues(operation)
+	gauge.Inc()
+	return gauge.Dec
+}
@@ -17,137 +17,469 @@ limitations under the License.
 package sfs
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/huaweicloud/external-sfs/pkg/config"
 	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
 	"github.com/kubernetes-incubator/external-storage/lib/controller"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kubernetes/pkg/controller/volume/events"
 )
 
 // Provisioner implements controller.Provisioner interface
 type Provisioner struct {
 	clientset    clientset.Interface
-	cloudconfig  config.CloudCredentials
+	name         string
+	recorder     record.EventRecorder
+	cloudconfig  *config.Store
+	credentials  *credentialsCache
 	sharetimeout int
-	vpcid        string
+	vpcs         *VPCCache
+	backoff      Backoff
+
+	keepFailedShares bool
+	clusterID        string
+	recycleRetention time.Duration
+}
+
+// ShareBackoff sets the intervals of polling share status
+func ShareBackoff(backoff Backoff) func(*Provisioner) {
+	return func(p *Provisioner) {
+		p.backoff = backoff
+	}
+}
+
+// ClusterID tags the shares with the id of the cluster
+func ClusterID(clusterID string) func(*Provisioner) {
+	return func(p *Provisioner) {
+		p.clusterID = clusterID
+	}
+}
+
+// KeepFailedShares keeps the shares of failed provisions for debugging instead of deleting them
+func KeepFailedShares(keepFailedShares bool) func(*Provisioner) {
+	return func(p *Provisioner) {
+		p.keepFailedShares = keepFailedShares
+	}
+}
+
+// RecycleRetention keeps the shares of deleted volumes in the recycle bin for the retention
+func RecycleRetention(retention time.Duration) func(*Provisioner) {
+	return func(p *Provisioner) {
+		p.recycleRetention = retention
+	}
 }
 
 // NewProvisioner creates a new instance of sfs provisioner
-func NewProvisioner(c clientset.Interface, cc config.CloudCredentials, timeout int, vpcid string) *Provisioner {
+func NewProvisioner(c clientset.Interface, name string, cc *config.Store, timeout int, vpcid string, options ...func(*Provisioner)) *Provisioner {
 
 	// init backends for provisioner
 	InitBackends()
 
-	// init vpc for provisioner
-	if vpcid == "" {
-		vpcid = InitVPC(cc)
-	}
-
 	// return provisioner instance
-	return &Provisioner{
+	p := &Provisioner{
 		clientset:    c,
+		name:         name,
+		recorder:     newEventRecorder(c, name),
 		cloudconfig:  cc,
+		credentials:  newCredentialsCache(),
 		sharetimeout: timeout,
-		vpcid:        vpcid,
+		vpcs:         NewVPCCache(cc, vpcid),
+		backoff:      DefaultBackoff,
+	}
+
+	for _, option := range options {
+		option(p)
 	}
+
+	return p
 }
 
 // Provision a share in sfs
 func (p *Provisioner) Provision(volOptions controller.VolumeOptions) (*v1.PersistentVolume, error) {
 
+	defer trackOperation(operationProvision)()
+
 	// selector check
 	glog.Infof("Provision volOptions: %v", volOptions)
 	if volOptions.PVC.Spec.Selector != nil {
 		return nil, fmt.Errorf("Claim Selector is not supported")
 	}
 
-	// init sfs client
+	// init sfs client of the credentials of the class
 	glog.Info("Init sfs client...")
-	client, err := p.cloudconfig.SFSV2Client()
+	cc, ref, err := p.classCredentials(volOptions.Parameters, volOptions.PVC)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get credentials: %v", err)
+	}
+	client, err := cc.SFSV2Client()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create SFS v2 client: %v", err)
 	}
 
-	// create share
-	glog.Info("Create share begin...")
-	share, err := CreateShare(client, &volOptions)
+	// select availability zone, existing shares keep their zone
+	var zone string
+	if !existingShare(volOptions.PVC) {
+		zone, err = p.selectZone(&volOptions)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to select availability zone: %v", err)
+		}
+	}
+	if zone != "" {
+		parameters := map[string]string{}
+		for k, v := range volOptions.Parameters {
+			parameters[k] = v
+		}
+		parameters[SFSParametersAvailability] = zone
+		volOptions.Parameters = parameters
+	}
+
+	// validate the backend options before creating the share
+	bo, err := p.buildBackendOptions(&volOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// provision and compensate the completed steps on failure
+	ctx, cancel := p.shareContext()
+	defer cancel()
+	tx := newProvisionTransaction(client, p.sharetimeout, p.backoff)
+	pv, zone, err := p.provision(ctx, client, tx, &volOptions, bo, ref)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create share: %v", err)
+		p.rollback(ctx, tx, volOptions.PVC)
+		return nil, err
+	}
+
+	// keep the consumers in the zone of the share
+	setTopology(pv, zone, cc.Global.Region)
+
+	// record the credentials owning the share for deletion
+	if ref != nil {
+		pv.Annotations[SFSAnnotationSecretName] = ref.name
+		pv.Annotations[SFSAnnotationSecretNamespace] = ref.namespace
+	}
+
+	return pv, nil
+}
+
+// provision a share and record the completed steps in the transaction,
+// returns the volume and the zone of the share
+func (p *Provisioner) provision(ctx context.Context, client *golangsdk.ServiceClient, tx *provisionTransaction, volOptions *controller.VolumeOptions, bo *backendOptions, ref *secretRef) (*v1.PersistentVolume, string, error) {
+
+	// restore share from the recycle bin or adopt an existing share
+	restoreID := volOptions.PVC.Annotations[SFSAnnotationRestoreShare]
+	adoptID := volOptions.PVC.Annotations[SFSAnnotationAdoptShare]
+	if restoreID != "" && adoptID != "" {
+		return nil, "", fmt.Errorf("Only one of the annotations %s and %s can be set", SFSAnnotationRestoreShare, SFSAnnotationAdoptShare)
+	}
+	share, created, err := p.findOrCreateShare(client, volOptions, ref, restoreID, adoptID)
+	if err != nil {
+		return nil, "", err
+	}
+	zone := volOptions.Parameters[SFSParametersAvailability]
+	if restoreID != "" || adoptID != "" {
+		zone = share.AvailabilityZone
+		if err := p.validateShareZone(volOptions.PVC, share); err != nil {
+			return nil, "", err
+		}
+		tx.shareAdopted(share.ID)
+	} else if created {
+		tx.shareCreated(share.ID)
+	} else {
+		tx.shareResumed(share.ID)
 	}
 
 	// wait fo share available
 	glog.Infof("Wait fo share available: %s", share.ID)
-	err = WaitForShareStatus(client, share.ID, SFSStatusAvailable, p.sharetimeout)
+	start := time.Now()
+	err = WaitForShareStatus(ctx, client, share.ID, SFSStatusAvailable, p.backoff)
+	observePhase(phaseWait, start, err)
 	if err != nil {
-		return nil, fmt.Errorf("Waiting for share %s to become created failed: %v", share.ID, err)
+		if IsShareFailed(err) {
+			tx.shareFailed()
+		}
+		p.recordShareFailure(volOptions.PVC, err)
+		return nil, "", fmt.Errorf("Waiting for share %s to become created failed: %v", share.ID, err)
 	}
 
 	// get new share
 	glog.Infof("Get share: %s", share.ID)
 	share, err = GetShare(client, share.ID)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to get share: %v", err)
+		return nil, "", fmt.Errorf("Failed to get share: %v", err)
 	}
 
-	// grant access
-	glog.Infof("Grant access: %s", share.ID)
-	err = GrantAccess(client, &volOptions, share.ID, p.vpcid)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to grant access: %v", err)
+	// keep the access rules granted before the share was adopted
+	existing := map[string]bool{}
+	if adoptID != "" {
+		existing, err = existingAccess(client, share.ID)
+		if err != nil {
+			return nil, "", err
+		}
 	}
 
-	// get location
-	location := share.ExportLocation
-	if (len(location) == 0) && (len(share.ExportLocations) > 0) {
-		location = share.ExportLocations[0]
-	}
-	if len(location) == 0 {
-		return nil, fmt.Errorf("Failed to get share %s location", share.ID)
+	// grant access to the vpcs, required by the protocol and the extra access rules of the class
+	start = time.Now()
+	grantedIDs, err := p.grantAccess(ctx, client, tx, share.ID, bo.accesses, existing)
+	observePhase(phaseGrant, start, err)
+	if err != nil {
+		return nil, "", err
 	}
-	glog.Infof("Get share: %s location: %s", share.ID, location)
 
-	// get backend
-	glog.Infof("Get backend: %s share protocal: %s", share.ID, share.ShareProto)
-	b, err := GetBackend(share.ShareProto)
+	// get location
+	location, err := SelectShareLocation(client, share, volOptions.Parameters)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get backend: %v", err)
+		return nil, "", err
 	}
+	glog.Infof("Get share: %s location: %s", share.ID, location)
 
 	// get persistent volume source
 	glog.Infof("Build source from share: %v", share)
-	pvsource, err := b.BuildSource(&backends.BuildSourceArgs{Location: location})
+	pvsource, err := bo.backend.BuildSource(&backends.BuildSourceArgs{
+		Location:     location,
+		MountOptions: bo.mountOptions,
+		Parameters:   volOptions.Parameters,
+		ReadOnly:     bo.readOnly,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("Failed to build source from backend: %v", err)
+		return nil, "", fmt.Errorf("Failed to build source from backend: %v", err)
+	}
+
+	// the capacity of an existing share is its size
+	capacity := volOptions.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)]
+	if restoreID != "" || adoptID != "" {
+		capacity = shareCapacity(share)
+	}
+	annotations := map[string]string{
+		SFSAnnotationID: share.ID,
+	}
+
+	// take restored share out of the recycle bin
+	if restoreID != "" {
+		glog.Infof("Restore share %s from the recycle bin", share.ID)
+		if err := restoreShare(client, share.ID); err != nil {
+			return nil, "", err
+		}
+		p.recorder.Eventf(volOptions.PVC, v1.EventTypeNormal, SFSEventShareRestored,
+			"Share %s restored from the recycle bin", share.ID)
+	}
+
+	// record how to release adopted share
+	if adoptID != "" {
+		err = adoptedAnnotations(annotations, volOptions.Parameters, grantedIDs)
+		if err != nil {
+			return nil, "", err
+		}
+		p.recorder.Eventf(volOptions.PVC, v1.EventTypeNormal, SFSEventShareAdopted,
+			"Existing share %s adopted", share.ID)
 	}
 
-	return &v1.PersistentVolume{
+	pv := &v1.PersistentVolume{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: volOptions.PVName,
-			Annotations: map[string]string{
-				SFSAnnotationID: share.ID,
-			},
+			Name:        volOptions.PVName,
+			Annotations: annotations,
 		},
 		Spec: v1.PersistentVolumeSpec{
 			PersistentVolumeReclaimPolicy: volOptions.PersistentVolumeReclaimPolicy,
 			AccessModes:                   volOptions.PVC.Spec.AccessModes,
 			Capacity: v1.ResourceList{
-				v1.ResourceName(v1.ResourceStorage): volOptions.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)],
+				v1.ResourceName(v1.ResourceStorage): capacity,
 			},
 			PersistentVolumeSource: *pvsource,
+			MountOptions:           bo.mountOptions,
 		},
-	}, nil
+	}
+	return pv, zone, nil
+}
+
+// grantAccess grants the access rules of the protocol and the extra rules of the class to the share
+// and waits for them to become active, the ids of the rules which did not exist before are returned.
+// An extra rule repeating another one is granted once, so that it is revoked once on rollback.
+func (p *Provisioner) grantAccess(ctx context.Context, client *golangsdk.ServiceClient, tx *provisionTransaction, shareID string, accesses []backends.Access, existing map[string]bool) ([]string, error) {
+	var accessIDs, grantedIDs []string
+	seen := map[string]bool{}
+	for _, a := range accesses {
+		key := accessKey(a.AccessType, a.AccessTo)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		glog.Infof("Grant %s access to %s: %s", a.AccessType, a.AccessTo, shareID)
+		access, err := GrantAccessRule(client, shareID, a)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to grant %s access to %s: %v", a.AccessType, a.AccessTo, err)
+		}
+		accessIDs = append(accessIDs, access.ID)
+		if existing[key] {
+			continue
+		}
+		tx.accessGranted(access.ID)
+		grantedIDs = append(grantedIDs, access.ID)
+	}
+
+	// wait for access rules active
+	glog.Infof("Wait for access rules active: %s", shareID)
+	err := WaitForAccessActive(ctx, client, shareID, accessIDs, p.backoff)
+	if err != nil {
+		return nil, fmt.Errorf("Waiting for access rules of share %s to become active failed: %v", shareID, err)
+	}
+	return grantedIDs, nil
+}
+
+// findOrCreateShare returns the share of the recycle bin to restore, the existing share to adopt,
+// the share created by a previous attempt or a new share, created reports whether the share is new
+func (p *Provisioner) findOrCreateShare(client *golangsdk.ServiceClient, volOptions *controller.VolumeOptions, ref *secretRef, restoreID, adoptID string) (*shares.Share, bool, error) {
+	if restoreID != "" {
+		share, err := p.recycledShare(client, volOptions.PVC, ref, restoreID)
+		if err != nil {
+			return nil, false, err
+		}
+		return share, false, validateShareSize(share, volOptions.PVC)
+	}
+	if adoptID != "" {
+		share, err := p.adoptableShare(client, volOptions, adoptID)
+		return share, false, err
+	}
+
+	// find share created by a previous attempt
+	name := GetShareName(volOptions.PVC)
+	share, err := FindShareByName(client, name)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to find share %s: %v", name, err)
+	}
+
+	// create share
+	if share != nil {
+		glog.Infof("Share %s already exists: %s status: %s", name, share.ID, share.Status)
+		return share, false, nil
+	}
+	glog.Info("Create share begin...")
+	start := time.Now()
+	share, err = CreateShare(client, volOptions, "", p.clusterID)
+	observePhase(phaseCreate, start, err)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to create share: %v", err)
+	}
+	return share, true, nil
+}
+
+// backendOptions are the options of the protocol backend of a share
+type backendOptions struct {
+	backend      backends.Backend
+	mountOptions []string
+	accesses     []backends.Access
+	readOnly     bool
+}
+
+// buildBackendOptions merges the mount options of the class with the defaults of the protocol backend
+// selected by the class and builds the access rules of the vpcs, the protocol and the class
+func (p *Provisioner) buildBackendOptions(volOptions *controller.VolumeOptions) (*backendOptions, error) {
+	b, err := SelectBackend(volOptions.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	readOnly, err := IsReadOnly(volOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	vpcs, err := VPCAccess(volOptions, p.vpcs.IDs())
+	if err != nil {
+		if err == ErrNoVPC {
+			p.recorder.Event(volOptions.PVC, v1.EventTypeWarning, SFSEventVPCNotFound, err.Error())
+		}
+		return nil, err
+	}
+
+	args := &backends.BuildSourceArgs{
+		MountOptions: volOptions.MountOptions,
+		Parameters:   volOptions.Parameters,
+		ReadOnly:     readOnly,
+	}
+	mountOptions, err := b.BuildMountOptions(args)
+	if err != nil {
+		p.recorder.Eventf(volOptions.PVC, v1.EventTypeWarning, SFSEventInvalidMountOptions,
+			"Invalid mount options %v: %v", volOptions.MountOptions, err)
+		return nil, fmt.Errorf("Invalid mount options: %v", err)
+	}
+	glog.Infof("Use mount options: %v", mountOptions)
+
+	accesses, err := b.BuildAccess(args)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid access parameters: %v", err)
+	}
+	rules, err := ParseAccessRules(volOptions.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	accesses = append(append(vpcs, accesses...), rules...)
+
+	err = ValidateLocationParameters(volOptions.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return &backendOptions{backend: b, mountOptions: mountOptions, accesses: accesses, readOnly: readOnly}, nil
+}
+
+// rollback compensates a failed provision unless failed shares are kept or the provision timed out
+func (p *Provisioner) rollback(ctx context.Context, tx *provisionTransaction, pvc *v1.PersistentVolumeClaim) {
+	if tx.empty() {
+		return
+	}
+
+	// a timed out provision is resumed by the next attempt
+	if ctx.Err() != nil && !tx.failed {
+		glog.Infof("Keep share %s of timed out provision", tx.shareID)
+		p.recorder.Eventf(pvc, v1.EventTypeNormal, SFSEventProvisioningRollbackSkipped,
+			"Share %s of timed out provision is kept to be resumed by the next attempt", tx.shareID)
+		return
+	}
+
+	if p.keepFailedShares {
+		glog.Infof("Keep share %s of failed provision", tx.shareID)
+		p.recorder.Eventf(pvc, v1.EventTypeWarning, SFSEventProvisioningRollbackSkipped,
+			"Share %s of failed provision is kept for debugging", tx.shareID)
+		return
+	}
+
+	cleaned, err := tx.rollback()
+	if err != nil {
+		glog.Errorf("Failed to rollback provision: %v", err)
+		p.recorder.Eventf(pvc, v1.EventTypeWarning, events.ProvisioningCleanupFailed,
+			"Failed to clean up failed provision: %v, cleaned up: %s", err, strings.Join(cleaned, ", "))
+		return
+	}
+
+	p.recorder.Eventf(pvc, v1.EventTypeNormal, SFSEventProvisioningRolledBack,
+		"Cleaned up failed provision: %s", strings.Join(cleaned, ", "))
 }
 
 // Delete a share from sfs
 func (p *Provisioner) Delete(pv *v1.PersistentVolume) error {
+	defer trackOperation(operationDelete)()
 
-	// init sfs client
+	// init sfs client of the credentials owning the share
 	glog.Info("Init sfs client...")
-	client, err := p.cloudconfig.SFSV2Client()
+	cc, err := p.volumeCredentials(pv)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials: %v", err)
+	}
+	client, err := cc.SFSV2Client()
 	if err != nil {
 		return fmt.Errorf("Failed to create SFS v2 client: %v", err)
 	}
@@ -159,12 +491,73 @@ func (p *Provisioner) Delete(pv *v1.PersistentVolume) error {
 		return fmt.Errorf("Failed to get share id: %v", pv)
 	}
 
-	// delete share
+	// keep adopted share and revoke the access granted to the cluster
+	if pv.Annotations[SFSAnnotationKeepShare] == "true" {
+		glog.Infof("Release adopted share: %s", shareid)
+		return p.releaseShare(client, pv, shareid)
+	}
+
+	// keep share in the recycle bin, which must be able to reach it with the credentials of the volume
+	if p.recycleRetention > 0 {
+		ok, err := p.canRecycle(pv)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			p.recorder.Eventf(pv, v1.EventTypeWarning, SFSEventShareRecycleFailed,
+				"Share %s is neither recycled nor deleted: the recycle bin can not reach the shares of secret %s/%s, "+
+					"which is not referenced by a storage class of the provisioner",
+				shareid, pv.Annotations[SFSAnnotationSecretNamespace], pv.Annotations[SFSAnnotationSecretName])
+			return fmt.Errorf("Failed to recycle share %s: credentials unreachable by the recycle bin", shareid)
+		}
+		glog.Infof("Recycle share: %s", shareid)
+		return p.recycleShare(client, pv, shareid)
+	}
+
+	// delete share and wait until it is gone
 	glog.Infof("Delete share: %s", shareid)
-	err = DeleteShare(client, shareid)
+	ctx, cancel := p.shareContext()
+	defer cancel()
+	start := time.Now()
+	err = DeleteShareAndWait(ctx, client, shareid, p.backoff)
+	observePhase(phaseDelete, start, err)
 	if err != nil {
+		capacity := pv.Spec.Capacity[v1.ResourceStorage]
+		p.recorder.Eventf(pv, v1.EventTypeWarning, SFSEventShareDeletionFailed,
+			"Share %s of %s capacity may be leaked: %v", shareid, capacity.String(), err)
 		return fmt.Errorf("failed to delete share: %v", err)
 	}
 
 	return nil
 }
+
+// DiscoverVPCs resolves the vpcs of the cluster nodes until the stop channel is closed
+func (p *Provisioner) DiscoverVPCs(stopCh <-chan struct{}) {
+	p.vpcs.Run(p.clientset, stopCh)
+}
+
+// WaitForVPCs waits until the vpcs of the existing cluster nodes are resolved,
+// returns false if the stop channel is closed before
+func (p *Provisioner) WaitForVPCs(stopCh <-chan struct{}) bool {
+	return p.vpcs.WaitForSync(stopCh)
+}
+
+// shareContext returns a context which expires after the share timeout
+func (p *Provisioner) shareContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Duration(p.sharetimeout)*time.Second)
+}
+
+// recordShareFailure reports a share in a failure status to the object
+func (p *Provisioner) recordShareFailure(obj runtime.Object, err error) {
+	if IsShareFailed(err) {
+		p.recorder.Event(obj, v1.EventTypeWarning, SFSEventShareFailed, err.Error())
+	}
+}
+
+// newEventRecorder creates an event recorder reporting as the provisioner
+func newEventRecorder(c clientset.Interface, name string) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(glog.Infof)
+	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: c.CoreV1().Events(v1.NamespaceAll)})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: name})
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+)
+
+func TestGrantAccess(t *testing.T) {
+	vpc := backends.Access{AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "rw"}
+	extraVPC := backends.Access{AccessType: "cert", AccessTo: "vpc-2", AccessLevel: "rw"}
+	ip := backends.Access{AccessType: "ip", AccessTo: "10.0.0.0/24", AccessLevel: "ro"}
+
+	tests := []struct {
+		name        string
+		accesses    []backends.Access
+		existing    bool
+		accessState string
+		granted     int
+		valid       bool
+	}{
+		{
+			name:     "protocol and extra rules",
+			accesses: []backends.Access{vpc, extraVPC, ip},
+			granted:  3,
+			valid:    true,
+		},
+		{
+			name:     "extra rule repeating the protocol rule",
+			accesses: []backends.Access{vpc, vpc, ip},
+			granted:  2,
+			valid:    true,
+		},
+		{
+			name:     "existing rule of an adopted share",
+			accesses: []backends.Access{vpc, ip},
+			existing: true,
+			granted:  1,
+			valid:    true,
+		},
+		{
+			name:        "failed rule",
+			accesses:    []backends.Access{vpc},
+			accessState: SFSAccessStateError,
+			valid:       false,
+		},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		cloud.AccessState = test.accessState
+		share := &fake.Share{Share: shares.Share{ID: "share-1", Status: SFSStatusAvailable}}
+		existing := map[string]bool{}
+		if test.existing {
+			share.Access = []shares.AccessRight{
+				{ID: "old", AccessType: vpc.AccessType, AccessTo: vpc.AccessTo, AccessLevel: vpc.AccessLevel, State: SFSAccessStateActive},
+			}
+			existing[accessKey(vpc.AccessType, vpc.AccessTo)] = true
+		}
+		cloud.AddShare(share)
+		client := newFakeClient(t, cloud)
+		p := &Provisioner{backoff: testBackoff}
+		tx := newProvisionTransaction(client, 10, testBackoff)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		grantedIDs, err := p.grantAccess(ctx, client, tx, "share-1", test.accesses, existing)
+		cancel()
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s: expected valid %v, got %v", test.name, test.valid, err)
+		}
+		if len(grantedIDs) != test.granted {
+			t.Errorf("%s: expected %d granted rules, got %v", test.name, test.granted, grantedIDs)
+		}
+		if test.valid && !reflect.DeepEqual(tx.accessIDs, grantedIDs) {
+			t.Errorf("%s: expected the transaction to record %v, got %v", test.name, grantedIDs, tx.accessIDs)
+		}
+		cloud.Close()
+	}
+}
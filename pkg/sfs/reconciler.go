@@ -0,0 +1,235 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/pkg/apis/core/v1/helper"
+)
+
+// Defines the kinds of access rule drift
+const (
+	driftMissing    = "missing"
+	driftMismatched = "mismatched"
+	driftFailed     = "failed"
+	driftUndeclared = "undeclared"
+)
+
+// AccessReconciler periodically compares the access rules of the shares of the bound volumes
+// with the ones declared by their storage class, grants the missing rules and optionally
+// revokes the rules which are not declared.
+type AccessReconciler struct {
+	provisioner      *Provisioner
+	revokeUndeclared bool
+}
+
+// NewAccessReconciler creates a new access reconciler for the sfs provisioner
+func NewAccessReconciler(p *Provisioner, revokeUndeclared bool) *AccessReconciler {
+	return &AccessReconciler{
+		provisioner:      p,
+		revokeUndeclared: revokeUndeclared,
+	}
+}
+
+// Run reconciles the volumes every period until the stop channel is closed
+func (r *AccessReconciler) Run(period time.Duration, stopCh <-chan struct{}) {
+	glog.Infof("Starting access reconciler, period: %v revoke undeclared rules: %v", period, r.revokeUndeclared)
+	wait.Until(r.reconcileAll, period, stopCh)
+}
+
+// reconcileAll reconciles the bound volumes of the provisioner
+func (r *AccessReconciler) reconcileAll() {
+	pvs, err := r.provisioner.clientset.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		glog.Errorf("Failed to list persistent volumes: %v", err)
+		return
+	}
+
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if pv.Annotations[annDynamicallyProvisioned] != r.provisioner.name || pv.Annotations[SFSAnnotationID] == "" {
+			continue
+		}
+		if pv.Status.Phase != v1.VolumeBound || pv.DeletionTimestamp != nil {
+			continue
+		}
+		if err := r.reconcile(pv); err != nil {
+			accessReconcileErrorsTotal.Inc()
+			glog.Errorf("Failed to reconcile access rules of %s: %v", pv.Name, err)
+		}
+	}
+}
+
+// reconcile the access rules of the share of a volume
+func (r *AccessReconciler) reconcile(pv *v1.PersistentVolume) error {
+	shareID := pv.Annotations[SFSAnnotationID]
+	declared, err := r.declaredAccess(pv)
+	if err != nil {
+		return err
+	}
+
+	cc, err := r.provisioner.volumeCredentials(pv)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials: %v", err)
+	}
+	client, err := cc.SFSV2Client()
+	if err != nil {
+		return fmt.Errorf("Failed to create SFS v2 client: %v", err)
+	}
+
+	rights, err := shares.ListAccessRights(client, shareID).ExtractAccessRights()
+	if err != nil {
+		return fmt.Errorf("Failed to list access rules of share %s: %v", shareID, err)
+	}
+	existing := map[string]shares.AccessRight{}
+	for _, right := range rights {
+		existing[accessKey(right.AccessType, right.AccessTo)] = right
+	}
+
+	// grant the missing rules, replace the failed and mismatched ones
+	declaredKeys := map[string]bool{}
+	for _, d := range declared {
+		d := d
+		key := accessKey(d.AccessType, d.AccessTo)
+		declaredKeys[key] = true
+		grant := func() error {
+			_, err := GrantAccessRule(client, shareID, d)
+			return err
+		}
+
+		right, ok := existing[key]
+		switch {
+		case !ok:
+			r.reportDrift(pv, driftMissing, fmt.Sprintf("Access rule %s of share %s is missing", key, shareID), grant)
+		case right.State == SFSAccessStateError:
+			r.reportDrift(pv, driftFailed, fmt.Sprintf("Access rule %s of share %s is in state %s", key, shareID, right.State),
+				r.replaceAccess(client, shareID, right.ID, grant))
+		case right.AccessLevel != d.AccessLevel:
+			var repair func() error
+			if r.revokeUndeclared {
+				repair = r.replaceAccess(client, shareID, right.ID, grant)
+			}
+			r.reportDrift(pv, driftMismatched, fmt.Sprintf("Access rule %s of share %s has level %s instead of %s",
+				key, shareID, right.AccessLevel, d.AccessLevel), repair)
+		}
+	}
+
+	// report or revoke the undeclared rules, an adopted share keeps the rules granted before
+	for key, right := range existing {
+		if declaredKeys[key] || pv.Annotations[SFSAnnotationAdopted] == "true" {
+			continue
+		}
+		var repair func() error
+		if r.revokeUndeclared {
+			id := right.ID
+			repair = func() error {
+				return RevokeAccess(client, shareID, id)
+			}
+		}
+		r.reportDrift(pv, driftUndeclared, fmt.Sprintf("Access rule %s of share %s is not declared", key, shareID), repair)
+	}
+
+	return nil
+}
+
+// declaredAccess returns the access rules declared by the storage class of a volume
+func (r *AccessReconciler) declaredAccess(pv *v1.PersistentVolume) ([]backends.Access, error) {
+	className := helper.GetPersistentVolumeClass(pv)
+	class, err := r.provisioner.clientset.StorageV1().StorageClasses().Get(className, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get class %s: %v", className, err)
+	}
+
+	volOptions := &controller.VolumeOptions{
+		Parameters: class.Parameters,
+		PVC: &v1.PersistentVolumeClaim{
+			Spec: v1.PersistentVolumeClaimSpec{AccessModes: pv.Spec.AccessModes},
+		},
+	}
+	vpcs, err := VPCAccess(volOptions, r.provisioner.vpcs.IDs())
+	if err != nil {
+		return nil, err
+	}
+	readOnly, err := IsReadOnly(volOptions)
+	if err != nil {
+		return nil, err
+	}
+	b, err := SelectBackend(class.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	accesses, err := b.BuildAccess(&backends.BuildSourceArgs{Parameters: class.Parameters, ReadOnly: readOnly})
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseAccessRules(class.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := append(vpcs, accesses...)
+	return append(declared, rules...), nil
+}
+
+// reportDrift reports a drift as event and metric of the volume, the drift is repaired if repair is set
+func (r *AccessReconciler) reportDrift(pv *v1.PersistentVolume, kind, message string, repair func() error) {
+	glog.Warningf("%s: %s", pv.Name, message)
+	if repair == nil {
+		accessRuleDriftTotal.WithLabelValues(kind, "false").Inc()
+		r.provisioner.recorder.Event(pv, v1.EventTypeWarning, SFSEventAccessRuleDrift, message)
+		return
+	}
+
+	if err := repair(); err != nil {
+		accessRuleDriftTotal.WithLabelValues(kind, "false").Inc()
+		r.provisioner.recorder.Eventf(pv, v1.EventTypeWarning, SFSEventAccessRuleDrift, "%s, failed to repair: %v", message, err)
+		return
+	}
+	accessRuleDriftTotal.WithLabelValues(kind, "true").Inc()
+	r.provisioner.recorder.Eventf(pv, v1.EventTypeNormal, SFSEventAccessRuleRepaired, "%s, repaired", message)
+}
+
+// replaceAccess returns a repair revoking the access rule before granting it again,
+// the rule is granted once the revoked one disappeared from the share
+func (r *AccessReconciler) replaceAccess(client *golangsdk.ServiceClient, shareID, accessID string, grant func() error) func() error {
+	return func() error {
+		if err := RevokeAccess(client, shareID, accessID); err != nil {
+			return err
+		}
+		ctx, cancel := r.provisioner.shareContext()
+		defer cancel()
+		if err := WaitForAccessRevoked(ctx, client, shareID, accessID, r.provisioner.backoff); err != nil {
+			return err
+		}
+		return grant()
+	}
+}
+
+// accessKey identifies an access rule by type and target
+func accessKey(accessType, accessTo string) string {
+	return accessType + ":" + accessTo
+}
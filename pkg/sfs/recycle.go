@@ -0,0 +1,269 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// recycledMetadataKeys are the metadata keys of a share in the recycle bin
+var recycledMetadataKeys = []string{
+	SFSMetadataRecycledAt,
+	SFSMetadataRecycledPVCNamespace,
+	SFSMetadataRecycledPVCName,
+	SFSMetadataRecycledPV,
+	SFSMetadataRecycledSecretNamespace,
+	SFSMetadataRecycledSecretName,
+}
+
+// recycleShare moves the share of a deleted volume into the recycle bin: the access rules are
+// revoked and the deletion time and the claim are recorded in the share metadata.
+func (p *Provisioner) recycleShare(client *golangsdk.ServiceClient, pv *v1.PersistentVolume, shareID string) error {
+	rights, err := shares.ListAccessRights(client, shareID).ExtractAccessRights()
+	if err != nil {
+		return fmt.Errorf("Failed to list access rules of share %s: %v", shareID, err)
+	}
+	for _, right := range rights {
+		glog.Infof("Revoke access %s of recycled share %s", right.ID, shareID)
+		if err := RevokeAccess(client, shareID, right.ID); err != nil {
+			return fmt.Errorf("Failed to revoke access %s: %v", right.ID, err)
+		}
+	}
+
+	now := time.Now()
+	metadata := map[string]string{
+		SFSMetadataRecycledAt: now.UTC().Format(time.RFC3339),
+		SFSMetadataRecycledPV: pv.Name,
+	}
+	// adopted shares are not tagged yet
+	if p.clusterID != "" {
+		metadata[SFSMetadataClusterID] = p.clusterID
+	}
+	if ref := pv.Spec.ClaimRef; ref != nil {
+		metadata[SFSMetadataRecycledPVCNamespace] = ref.Namespace
+		metadata[SFSMetadataRecycledPVCName] = ref.Name
+	}
+	// the recycle bin empties the shares of a class secret with its credentials
+	if name := pv.Annotations[SFSAnnotationSecretName]; name != "" {
+		metadata[SFSMetadataRecycledSecretNamespace] = pv.Annotations[SFSAnnotationSecretNamespace]
+		metadata[SFSMetadataRecycledSecretName] = name
+	}
+	if err := SetShareMetadata(client, shareID, metadata); err != nil {
+		return fmt.Errorf("Failed to mark share %s recycled: %v", shareID, err)
+	}
+
+	p.recorder.Eventf(pv, v1.EventTypeNormal, SFSEventShareRecycled,
+		"Share %s is kept in the recycle bin until %s", shareID, now.Add(p.recycleRetention).UTC().Format(time.RFC3339))
+	return nil
+}
+
+// recycleSecrets returns the class secrets whose shares the recycle bin can reach, which are
+// the secrets of the classes of the provisioner not depending on the claim
+func (p *Provisioner) recycleSecrets() ([]secretRef, error) {
+	classes, err := p.clientset.StorageV1().StorageClasses().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list storage classes: %v", err)
+	}
+	seen := map[secretRef]bool{}
+	var refs []secretRef
+	for _, class := range classes.Items {
+		if class.Provisioner != p.name {
+			continue
+		}
+		ref := secretRef{
+			namespace: class.Parameters[SFSParametersSecretNamespace],
+			name:      class.Parameters[SFSParametersSecretName],
+		}
+		if ref.name == "" || ref.namespace == "" || strings.Contains(ref.name+ref.namespace, "${") || seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// canRecycle checks whether the recycle bin can reach the share of the volume to delete it after the retention
+func (p *Provisioner) canRecycle(pv *v1.PersistentVolume) (bool, error) {
+	ref := secretRef{
+		namespace: pv.Annotations[SFSAnnotationSecretNamespace],
+		name:      pv.Annotations[SFSAnnotationSecretName],
+	}
+	if ref.name == "" {
+		return true, nil
+	}
+	refs, err := p.recycleSecrets()
+	if err != nil {
+		return false, err
+	}
+	for _, r := range refs {
+		if r == ref {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recycledWith checks whether the share was recycled with the credentials of the class secret,
+// or with the global credentials if ref is nil
+func recycledWith(share *shares.Share, ref *secretRef) bool {
+	name := share.Metadata[SFSMetadataRecycledSecretName]
+	if ref == nil {
+		return name == ""
+	}
+	return name == ref.name && share.Metadata[SFSMetadataRecycledSecretNamespace] == ref.namespace
+}
+
+// recycledShare returns the share of the recycle bin to restore for the claim, shares can only be
+// restored into the namespace of their former claim and with the credentials they were recycled with.
+func (p *Provisioner) recycledShare(client *golangsdk.ServiceClient, pvc *v1.PersistentVolumeClaim, ref *secretRef, shareID string) (*shares.Share, error) {
+	share, err := GetShare(client, shareID)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get share %s to restore: %v", shareID, err)
+	}
+	if share.Metadata[SFSMetadataRecycledAt] == "" {
+		return nil, fmt.Errorf("Share %s is not in the recycle bin", shareID)
+	}
+	if share.Metadata[SFSMetadataRecycledPVCNamespace] != pvc.Namespace {
+		return nil, fmt.Errorf("Share %s was not recycled from namespace %s", shareID, pvc.Namespace)
+	}
+	if p.clusterID != "" && share.Metadata[SFSMetadataClusterID] != p.clusterID {
+		return nil, fmt.Errorf("Share %s does not belong to cluster %s", shareID, p.clusterID)
+	}
+	if !recycledWith(share, ref) {
+		return nil, fmt.Errorf("Share %s was recycled with other credentials than the ones of the class", shareID)
+	}
+	return share, nil
+}
+
+// restoreShare takes the share out of the recycle bin
+func restoreShare(client *golangsdk.ServiceClient, shareID string) error {
+	for _, key := range recycledMetadataKeys {
+		if err := DeleteShareMetadata(client, shareID, key); err != nil {
+			return fmt.Errorf("Failed to delete metadata %s of share %s: %v", key, shareID, err)
+		}
+	}
+	return nil
+}
+
+// RecycleBin deletes the shares of the recycle bin after the retention of the provisioner
+type RecycleBin struct {
+	provisioner *Provisioner
+}
+
+// NewRecycleBin creates a new recycle bin for the sfs provisioner
+func NewRecycleBin(p *Provisioner) *RecycleBin {
+	return &RecycleBin{provisioner: p}
+}
+
+// Run empties the recycle bin every period until the stop channel is closed
+func (b *RecycleBin) Run(period time.Duration, stopCh <-chan struct{}) {
+	glog.Infof("Starting recycle bin, period: %v retention: %v", period, b.provisioner.recycleRetention)
+	wait.Until(func() {
+		if err := b.empty(time.Now()); err != nil {
+			glog.Errorf("Failed to empty recycle bin: %v", err)
+		}
+	}, period, stopCh)
+}
+
+// empty deletes the recycled shares whose retention expired in the projects
+// of the global credentials and of the class secrets
+func (b *RecycleBin) empty(now time.Time) error {
+	refs, err := b.provisioner.recycleSecrets()
+	if err != nil {
+		return err
+	}
+
+	recycled := 0
+	count, err := b.emptyProject(b.provisioner.cloudconfig.Get(), nil, now)
+	if err != nil {
+		return err
+	}
+	recycled += count
+	for i := range refs {
+		cc, err := b.provisioner.credentials.get(b.provisioner.clientset, refs[i])
+		if err != nil {
+			glog.Errorf("Failed to get credentials of the recycle bin: %v", err)
+			continue
+		}
+		count, err := b.emptyProject(cc, &refs[i], now)
+		if err != nil {
+			glog.Errorf("Failed to empty recycle bin of secret %s/%s: %v", refs[i].namespace, refs[i].name, err)
+			continue
+		}
+		recycled += count
+	}
+
+	recycledShares.Set(float64(recycled))
+	return nil
+}
+
+// emptyProject deletes the expired shares recycled with the credentials and returns the number of kept ones
+func (b *RecycleBin) emptyProject(cc *config.CloudCredentials, ref *secretRef, now time.Time) (int, error) {
+	client, err := cc.SFSV2Client()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to create SFS v2 client: %v", err)
+	}
+	list, err := ListShares(client, shares.ListOpts{})
+	if err != nil {
+		return 0, fmt.Errorf("Failed to list shares: %v", err)
+	}
+
+	recycled := 0
+	for i := range list {
+		share := &list[i]
+		value := share.Metadata[SFSMetadataRecycledAt]
+		if value == "" {
+			continue
+		}
+		if clusterID := b.provisioner.clusterID; clusterID != "" && share.Metadata[SFSMetadataClusterID] != clusterID {
+			continue
+		}
+		// a project reached by several credentials is emptied with the recorded ones
+		if !recycledWith(share, ref) {
+			continue
+		}
+		recycledAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			glog.Errorf("Invalid recycle time %s of share %s: %v", value, share.ID, err)
+			continue
+		}
+
+		if now.Sub(recycledAt) < b.provisioner.recycleRetention {
+			recycled++
+			continue
+		}
+		glog.Infof("Delete share %s recycled at %s from the recycle bin", share.ID, value)
+		if err := DeleteShare(client, share.ID); err != nil {
+			recycled++
+			glog.Errorf("Failed to delete recycled share %s: %v", share.ID, err)
+			continue
+		}
+		recycledSharesDeletedTotal.Inc()
+	}
+	return recycled, nil
+}
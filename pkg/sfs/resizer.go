@@ -0,0 +1,361 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/kubernetes/pkg/apis/core/v1/helper"
+)
+
+const (
+	// annDynamicallyProvisioned is set by the provision controller on the PVs it creates
+	annDynamicallyProvisioned = "pv.kubernetes.io/provisioned-by"
+
+	// resizeResyncPeriod is the resync period of the claim informer
+	resizeResyncPeriod = 15 * time.Minute
+)
+
+// ResizeController expands shares when the storage request of a bound claim grows
+type ResizeController struct {
+	provisioner     *Provisioner
+	claims          cache.Store
+	claimController cache.Controller
+	claimQueue      workqueue.RateLimitingInterface
+}
+
+// NewResizeController creates a new resize controller for the sfs provisioner
+func NewResizeController(p *Provisioner) *ResizeController {
+	ctrl := &ResizeController{
+		provisioner: p,
+		claimQueue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "resize"),
+	}
+
+	claimSource := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return p.clientset.CoreV1().PersistentVolumeClaims(v1.NamespaceAll).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return p.clientset.CoreV1().PersistentVolumeClaims(v1.NamespaceAll).Watch(options)
+		},
+	}
+
+	claimHandler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { ctrl.enqueueClaim(obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) { ctrl.enqueueClaim(newObj) },
+		DeleteFunc: func(obj interface{}) { ctrl.forgetClaim(obj) },
+	}
+
+	ctrl.claims, ctrl.claimController = cache.NewInformer(
+		claimSource,
+		&v1.PersistentVolumeClaim{},
+		resizeResyncPeriod,
+		claimHandler,
+	)
+
+	return ctrl
+}
+
+// Run starts the resize controller until the stop channel is closed
+func (ctrl *ResizeController) Run(stopCh <-chan struct{}) {
+	glog.Info("Starting resize controller")
+	defer utilruntime.HandleCrash()
+	defer ctrl.claimQueue.ShutDown()
+
+	go ctrl.claimController.Run(stopCh)
+	if !cache.WaitForCacheSync(stopCh, ctrl.claimController.HasSynced) {
+		glog.Error("Failed to sync claim cache for resize controller")
+		return
+	}
+
+	go wait.Until(ctrl.runClaimWorker, time.Second, stopCh)
+
+	<-stopCh
+}
+
+// enqueueClaim adds a claim to the work queue
+func (ctrl *ResizeController) enqueueClaim(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	ctrl.claimQueue.Add(key)
+}
+
+// forgetClaim stops tracking retries of a deleted claim
+func (ctrl *ResizeController) forgetClaim(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	ctrl.claimQueue.Forget(key)
+}
+
+// runClaimWorker processes claims until the queue is shut down
+func (ctrl *ResizeController) runClaimWorker() {
+	for ctrl.processNextClaim() {
+	}
+}
+
+// processNextClaim syncs a single claim from the work queue
+func (ctrl *ResizeController) processNextClaim() bool {
+	obj, shutdown := ctrl.claimQueue.Get()
+	if shutdown {
+		return false
+	}
+	defer ctrl.claimQueue.Done(obj)
+
+	key := obj.(string)
+	claimObj, exists, err := ctrl.claims.GetByKey(key)
+	if err != nil || !exists {
+		ctrl.claimQueue.Forget(obj)
+		return true
+	}
+
+	if err := ctrl.syncClaim(claimObj.(*v1.PersistentVolumeClaim)); err != nil {
+		glog.Errorf("Failed to resize claim %s: %v", key, err)
+		ctrl.claimQueue.AddRateLimited(obj)
+		return true
+	}
+
+	ctrl.claimQueue.Forget(obj)
+	return true
+}
+
+// syncClaim expands the share of a claim whose storage request exceeds its volume capacity
+func (ctrl *ResizeController) syncClaim(pvc *v1.PersistentVolumeClaim) error {
+	p := ctrl.provisioner
+
+	// only bound claims can be resized
+	if pvc.Status.Phase != v1.ClaimBound || pvc.Spec.VolumeName == "" {
+		return nil
+	}
+
+	if !claimNeedsResize(pvc) {
+		return nil
+	}
+
+	// check storage class
+	className := helper.GetPersistentVolumeClaimClass(pvc)
+	if className == "" {
+		return nil
+	}
+	class, err := p.clientset.StorageV1().StorageClasses().Get(className, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to get storage class %s: %v", className, err)
+	}
+	if class.Provisioner != p.name {
+		return nil
+	}
+	if class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		glog.V(4).Infof("Storage class %s does not allow volume expansion, skip claim %s/%s",
+			className, pvc.Namespace, pvc.Name)
+		return nil
+	}
+
+	// check persistent volume
+	pv, err := p.clientset.CoreV1().PersistentVolumes().Get(pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to get persistent volume %s: %v", pvc.Spec.VolumeName, err)
+	}
+	if pv.Annotations[annDynamicallyProvisioned] != p.name {
+		return nil
+	}
+	shareID := pv.Annotations[SFSAnnotationID]
+	if shareID == "" {
+		return nil
+	}
+
+	// the cached claim may be stale after a previous resize
+	pvc, err = p.clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(pvc.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("Failed to get claim %s/%s: %v", pvc.Namespace, pvc.Name, err)
+	}
+	if !claimNeedsResize(pvc) {
+		return nil
+	}
+
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	current := pvc.Status.Capacity[v1.ResourceStorage]
+	glog.Infof("Resize claim %s/%s share %s from %s to %s",
+		pvc.Namespace, pvc.Name, shareID, current.String(), requested.String())
+	err = ctrl.resizeClaim(pvc, pv, shareID)
+	if err != nil {
+		p.recorder.Event(pvc, v1.EventTypeWarning, SFSEventVolumeResizeFailed, err.Error())
+		return err
+	}
+
+	p.recorder.Eventf(pvc, v1.EventTypeNormal, SFSEventVolumeResizeSuccessful,
+		"Share %s expanded to %s", shareID, requested.String())
+	return nil
+}
+
+// resizeClaim expands the share and records the new capacity on the volume and the claim
+func (ctrl *ResizeController) resizeClaim(pvc *v1.PersistentVolumeClaim, pv *v1.PersistentVolume, shareID string) error {
+	p := ctrl.provisioner
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+
+	size, err := getStorageSize(pvc)
+	if err != nil {
+		return fmt.Errorf("Couldn't retrieve PVC storage size: %v", err)
+	}
+
+	// mark claim resizing
+	pvc, err = ctrl.updateClaimCondition(pvc, v1.PersistentVolumeClaimCondition{
+		Type:               v1.PersistentVolumeClaimResizing,
+		Status:             v1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to mark claim resizing: %v", err)
+	}
+
+	// expand share and update volume capacity, report the failure on the claim
+	err = ctrl.expandVolume(pvc, pv, shareID, size)
+	if err != nil {
+		ctrl.markResizeFailed(pvc, err)
+		return err
+	}
+
+	// update claim capacity and drop the resizing condition
+	pvc = pvc.DeepCopy()
+	if pvc.Status.Capacity == nil {
+		pvc.Status.Capacity = v1.ResourceList{}
+	}
+	pvc.Status.Capacity[v1.ResourceStorage] = requested
+	pvc.Status.Conditions = removeClaimCondition(pvc.Status.Conditions, v1.PersistentVolumeClaimResizing)
+	_, err = p.clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).UpdateStatus(pvc)
+	if err != nil {
+		return fmt.Errorf("Failed to update claim %s/%s capacity: %v", pvc.Namespace, pvc.Name, err)
+	}
+
+	return nil
+}
+
+// expandVolume expands the share and waits for the new size before updating the volume capacity
+func (ctrl *ResizeController) expandVolume(pvc *v1.PersistentVolumeClaim, pv *v1.PersistentVolume, shareID string, size int) error {
+	p := ctrl.provisioner
+	requested := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+
+	// init sfs client
+	cc, err := p.volumeCredentials(pv)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials: %v", err)
+	}
+	client, err := cc.SFSV2Client()
+	if err != nil {
+		return fmt.Errorf("Failed to create SFS v2 client: %v", err)
+	}
+
+	// expand share, unless a previous attempt already did
+	share, err := GetShare(client, shareID)
+	if err != nil {
+		return fmt.Errorf("Failed to get share %s: %v", shareID, err)
+	}
+	if share.Size < size {
+		glog.Infof("Expand share %s from %dGB to %dGB", shareID, share.Size, size)
+		err = ExpandShare(client, shareID, size)
+		if err != nil {
+			return fmt.Errorf("Failed to expand share %s: %v", shareID, err)
+		}
+	}
+
+	// wait for share available
+	ctx, cancel := p.shareContext()
+	defer cancel()
+	err = WaitForShareStatus(ctx, client, shareID, SFSStatusAvailable, p.backoff)
+	if err != nil {
+		p.recordShareFailure(pvc, err)
+		return fmt.Errorf("Waiting for share %s to be expanded failed: %v", shareID, err)
+	}
+	share, err = GetShare(client, shareID)
+	if err != nil {
+		return fmt.Errorf("Failed to get share %s: %v", shareID, err)
+	}
+	if share.Size < size {
+		return fmt.Errorf("Share %s is available with %dGB instead of %dGB", shareID, share.Size, size)
+	}
+
+	// update persistent volume capacity
+	pv = pv.DeepCopy()
+	pv.Spec.Capacity[v1.ResourceStorage] = requested
+	_, err = p.clientset.CoreV1().PersistentVolumes().Update(pv)
+	if err != nil {
+		return fmt.Errorf("Failed to update persistent volume %s capacity: %v", pv.Name, err)
+	}
+	return nil
+}
+
+// markResizeFailed replaces the resizing condition of the claim by a failed one
+func (ctrl *ResizeController) markResizeFailed(pvc *v1.PersistentVolumeClaim, resizeErr error) {
+	_, err := ctrl.updateClaimCondition(pvc, v1.PersistentVolumeClaimCondition{
+		Type:               v1.PersistentVolumeClaimResizing,
+		Status:             v1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             SFSEventVolumeResizeFailed,
+		Message:            resizeErr.Error(),
+	})
+	if err != nil {
+		glog.Errorf("Failed to mark claim %s/%s resize failed: %v", pvc.Namespace, pvc.Name, err)
+	}
+}
+
+// claimNeedsResize checks whether the storage request exceeds the claim capacity
+func claimNeedsResize(pvc *v1.PersistentVolumeClaim) bool {
+	requested, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	if !ok {
+		return false
+	}
+	current := pvc.Status.Capacity[v1.ResourceStorage]
+	return requested.Cmp(current) > 0
+}
+
+// updateClaimCondition sets a status condition on the claim
+func (ctrl *ResizeController) updateClaimCondition(pvc *v1.PersistentVolumeClaim, condition v1.PersistentVolumeClaimCondition) (*v1.PersistentVolumeClaim, error) {
+	for _, c := range pvc.Status.Conditions {
+		if c.Type == condition.Type && c.Status == condition.Status {
+			return pvc, nil
+		}
+	}
+
+	pvc = pvc.DeepCopy()
+	pvc.Status.Conditions = append(removeClaimCondition(pvc.Status.Conditions, condition.Type), condition)
+	return ctrl.provisioner.clientset.CoreV1().PersistentVolumeClaims(pvc.Namespace).UpdateStatus(pvc)
+}
+
+// removeClaimCondition returns the conditions without the given type
+func removeClaimCondition(conditions []v1.PersistentVolumeClaimCondition, conditionType v1.PersistentVolumeClaimConditionType) []v1.PersistentVolumeClaimCondition {
+	var result []v1.PersistentVolumeClaimCondition
+	for _, c := range conditions {
+		if c.Type != conditionType {
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/huaweicloud/external-sfs/pkg/config"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestSyncClaim(t *testing.T) {
+	tests := []struct {
+		name         string
+		extendStatus string
+		resized      bool
+		event        string
+	}{
+		{
+			name:    "expanded",
+			resized: true,
+			event:   SFSEventVolumeResizeSuccessful,
+		},
+		{
+			name:         "extending error",
+			extendStatus: SFSStatusExtendingError,
+			resized:      false,
+			event:        SFSEventVolumeResizeFailed,
+		},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		cloud.ExtendStatus = test.extendStatus
+		cloud.AddShare(&fake.Share{Share: shares.Share{ID: "share-1", Status: SFSStatusAvailable, Size: 1}})
+
+		allowExpansion := true
+		class := &storagev1.StorageClass{
+			ObjectMeta:           metav1.ObjectMeta{Name: "sfs"},
+			Provisioner:          "sfs-provisioner",
+			AllowVolumeExpansion: &allowExpansion,
+		}
+		pv := &v1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pv-1",
+				Annotations: map[string]string{
+					annDynamicallyProvisioned: "sfs-provisioner",
+					SFSAnnotationID:           "share-1",
+				},
+			},
+			Spec: v1.PersistentVolumeSpec{
+				Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		}
+		className := "sfs"
+		pvc := &v1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "claim-1"},
+			Spec: v1.PersistentVolumeClaimSpec{
+				StorageClassName: &className,
+				VolumeName:       "pv-1",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceStorage: resource.MustParse("2Gi")},
+				},
+			},
+			Status: v1.PersistentVolumeClaimStatus{
+				Phase:    v1.ClaimBound,
+				Capacity: v1.ResourceList{v1.ResourceStorage: resource.MustParse("1Gi")},
+			},
+		}
+		api := fake.NewAPIServer(class, pv, pvc)
+		recorder := record.NewFakeRecorder(10)
+		ctrl := &ResizeController{provisioner: &Provisioner{
+			name:         "sfs-provisioner",
+			clientset:    api.Clientset(),
+			cloudconfig:  config.NewStore(cloud.Credentials()),
+			recorder:     recorder,
+			sharetimeout: 10,
+			backoff:      testBackoff,
+		}}
+
+		err := ctrl.syncClaim(pvc)
+		if resized := err == nil; resized != test.resized {
+			t.Errorf("%s: expected resized %v, got %v", test.name, test.resized, err)
+		}
+
+		claim, err := api.Clientset().CoreV1().PersistentVolumeClaims("default").Get("claim-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s: failed to get claim: %v", test.name, err)
+		}
+		capacity := claim.Status.Capacity[v1.ResourceStorage]
+		if resized := capacity.Cmp(resource.MustParse("2Gi")) == 0; resized != test.resized {
+			t.Errorf("%s: expected resized %v, got capacity %s", test.name, test.resized, capacity.String())
+		}
+		for _, c := range claim.Status.Conditions {
+			if c.Type != v1.PersistentVolumeClaimResizing {
+				continue
+			}
+			if test.resized || c.Status != v1.ConditionFalse || c.Reason != SFSEventVolumeResizeFailed {
+				t.Errorf("%s: unexpected resizing condition %+v", test.name, c)
+			}
+		}
+		if !test.resized && len(claim.Status.Conditions) != 1 {
+			t.Errorf("%s: expected a failed resizing condition, got %+v", test.name, claim.Status.Conditions)
+		}
+
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		if !strings.Contains(strings.Join(events, "\n"), test.event) {
+			t.Errorf("%s: expected event %s, got %v", test.name, test.event, events)
+		}
+
+		api.Close()
+		cloud.Close()
+	}
+}
@@ -19,23 +19,25 @@ package sfs
 import (
 	"fmt"
 	"strconv"
-	"time"
 
 	"github.com/golang/glog"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
 	"github.com/huaweicloud/golangsdk"
 	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"github.com/huaweicloud/golangsdk/pagination"
 	"github.com/kubernetes-incubator/external-storage/lib/controller"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/controller/volume/persistentvolume"
 )
 
-// CreateShare in SFS
-func CreateShare(client *golangsdk.ServiceClient, volOptions *controller.VolumeOptions) (*shares.Share, error) {
+// CreateShare in SFS, pre-populated from the snapshot if snapshotID is not empty
+// and tagged with the cluster if clusterID is not empty
+func CreateShare(client *golangsdk.ServiceClient, volOptions *controller.VolumeOptions, snapshotID string, clusterID string) (*shares.Share, error) {
 	// build share createOpts
 	createOpts := shares.CreateOpts{}
 	// build name
-	createOpts.Name = "pvc-" + string(volOptions.PVC.GetUID())
+	createOpts.Name = GetShareName(volOptions.PVC)
 	// build share proto
 	createOpts.ShareProto = volOptions.Parameters[SFSParametersProtocol]
 	if createOpts.ShareProto == "" {
@@ -57,12 +59,17 @@ func CreateShare(client *golangsdk.ServiceClient, volOptions *controller.VolumeO
 	if tp != "" {
 		createOpts.ShareType = tp
 	}
+	// build snapshot
+	createOpts.SnapshotID = snapshotID
 	// build metadata
 	createOpts.Metadata = map[string]string{
 		persistentvolume.CloudVolumeCreatedForClaimNamespaceTag: volOptions.PVC.Namespace,
 		persistentvolume.CloudVolumeCreatedForClaimNameTag:      volOptions.PVC.Name,
 		persistentvolume.CloudVolumeCreatedForVolumeNameTag:     createOpts.Name,
 	}
+	if clusterID != "" {
+		createOpts.Metadata[SFSMetadataClusterID] = clusterID
+	}
 
 	// create share
 	glog.Infof("Create share createOpts: %v", createOpts)
@@ -73,17 +80,9 @@ func CreateShare(client *golangsdk.ServiceClient, volOptions *controller.VolumeO
 	return share, nil
 }
 
-// WaitForShareStatus wait for share desired status until timeout
-func WaitForShareStatus(client *golangsdk.ServiceClient, shareID string, desiredStatus string, timeout int) error {
-	return golangsdk.WaitFor(timeout, func() (bool, error) {
-		// reduce the amount of API calls
-		time.Sleep(2 * time.Second)
-		share, err := GetShare(client, shareID)
-		if err != nil {
-			return false, err
-		}
-		return share.Status == desiredStatus, nil
-	})
+// GetShareName returns the name of the share created for pvc
+func GetShareName(pvc *v1.PersistentVolumeClaim) string {
+	return "pvc-" + string(pvc.GetUID())
 }
 
 // GetShare in SFS
@@ -91,22 +90,123 @@ func GetShare(client *golangsdk.ServiceClient, shareID string) (*shares.Share, e
 	return shares.Get(client, shareID).Extract()
 }
 
-// GrantAccess in SFS
-func GrantAccess(client *golangsdk.ServiceClient, volOptions *controller.VolumeOptions, shareID string, vpcid string) error {
-	// build GrantAccessOpts
-	grantAccessOpts := shares.GrantAccessOpts{}
-	grantAccessOpts.AccessLevel = "rw"
-	grantAccessOpts.AccessType = "cert"
-	// build vpcid
-	id := volOptions.Parameters[SFSParametersVPCID]
-	if id != "" {
-		grantAccessOpts.AccessTo = id
-	} else {
-		grantAccessOpts.AccessTo = vpcid
+// ListShares in SFS. Unlike shares.List, which drops the error of the pager and then
+// panics on the missing page, a failed request is returned as error.
+func ListShares(client *golangsdk.ServiceClient, opts shares.ListOpts) ([]shares.Share, error) {
+	query, err := golangsdk.BuildQueryString(&opts)
+	if err != nil {
+		return nil, err
+	}
+	url := client.ServiceURL("shares", "detail") + query.String()
+	pages, err := pagination.NewPager(client, url, func(r pagination.PageResult) pagination.Page {
+		return shares.SharePage{LinkedPageBase: pagination.LinkedPageBase{PageResult: r}}
+	}).AllPages()
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := shares.ExtractShares(pages)
+	if err != nil {
+		return nil, err
+	}
+	return shares.FilterShares(list, opts)
+}
+
+// FindShareByName in SFS, returns nil if no share has the name
+func FindShareByName(client *golangsdk.ServiceClient, name string) (*shares.Share, error) {
+	list, err := ListShares(client, shares.ListOpts{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		// the name filter of some endpoints is a fuzzy match
+		if list[i].Name == name {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GrantAccess in SFS to the vpc of the class or the vpcs of the cluster, returns the access rules of the share
+func GrantAccess(client *golangsdk.ServiceClient, volOptions *controller.VolumeOptions, shareID string, vpcids []string) ([]*shares.AccessRight, error) {
+	accesses, err := VPCAccess(volOptions, vpcids)
+	if err != nil {
+		return nil, err
+	}
+
+	var rights []*shares.AccessRight
+	for _, access := range accesses {
+		right, err := GrantAccessRule(client, shareID, access)
+		if err != nil {
+			return nil, err
+		}
+		rights = append(rights, right)
+	}
+	return rights, nil
+}
+
+// GrantAccessRule in SFS, returns the access rule of the share
+func GrantAccessRule(client *golangsdk.ServiceClient, shareID string, access backends.Access) (*shares.AccessRight, error) {
+	// skip if a previous attempt already granted access,
+	// failed rules and rules being revoked do not grant access
+	rights, err := shares.ListAccessRights(client, shareID).ExtractAccessRights()
+	if err != nil {
+		return nil, err
+	}
+	for i := range rights {
+		if rights[i].State == SFSAccessStateError || rights[i].State == SFSAccessStateDenying {
+			continue
+		}
+		if rights[i].AccessType == access.AccessType && rights[i].AccessTo == access.AccessTo {
+			glog.Infof("Access to %s %s is already granted: %s", access.AccessType, access.AccessTo, shareID)
+			return &rights[i], nil
+		}
 	}
 
 	// grant access
-	result := shares.GrantAccess(client, shareID, grantAccessOpts)
+	grantAccessOpts := shares.GrantAccessOpts{
+		AccessLevel: access.AccessLevel,
+		AccessType:  access.AccessType,
+		AccessTo:    access.AccessTo,
+	}
+	return shares.GrantAccess(client, shareID, grantAccessOpts).ExtractAccess()
+}
+
+// SetShareMetadata in SFS, the given keys are added or updated
+func SetShareMetadata(client *golangsdk.ServiceClient, shareID string, metadata map[string]string) error {
+	body := map[string]interface{}{"metadata": metadata}
+	_, err := client.Post(client.ServiceURL("shares", shareID, "metadata"), body, nil, &golangsdk.RequestOpts{
+		OkCodes: []int{200},
+	})
+	return err
+}
+
+// DeleteShareMetadata in SFS, a missing key is deleted already
+func DeleteShareMetadata(client *golangsdk.ServiceClient, shareID string, key string) error {
+	_, err := client.Delete(client.ServiceURL("shares", shareID, "metadata", key), nil)
+	if _, ok := err.(golangsdk.ErrDefault404); ok {
+		return nil
+	}
+	return err
+}
+
+// RevokeAccess in SFS
+func RevokeAccess(client *golangsdk.ServiceClient, shareID string, accessID string) error {
+	result := shares.DeleteAccess(client, shareID, shares.DeleteAccessOpts{AccessID: accessID})
+	if result.Err != nil {
+		return result.Err
+	}
+	return nil
+}
+
+// ExpandShare in SFS
+func ExpandShare(client *golangsdk.ServiceClient, shareID string, size int) error {
+	// build ExpandOpts
+	expandOpts := shares.ExpandOpts{}
+	expandOpts.OSExtend.NewSize = size
+
+	// expand share
+	result := shares.Expand(client, shareID, expandOpts)
 	if result.Err != nil {
 		return result.Err
 	}
@@ -122,6 +222,15 @@ func DeleteShare(client *golangsdk.ServiceClient, shareID string) error {
 	return nil
 }
 
+// ForceDeleteShare in SFS regardless of its status
+func ForceDeleteShare(client *golangsdk.ServiceClient, shareID string) error {
+	body := map[string]interface{}{"os-force_delete": nil}
+	_, err := client.Post(client.ServiceURL("shares", shareID, "action"), body, nil, &golangsdk.RequestOpts{
+		OkCodes: []int{202},
+	})
+	return err
+}
+
 // getStorageSize from pvc
 func getStorageSize(pvc *v1.PersistentVolumeClaim) (int, error) {
 	errStorageSizeNotConfigured := fmt.Errorf("Requested storage capacity must be set")
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/huaweicloud/external-sfs/pkg/sfs/backends"
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+)
+
+// newFakeClient returns a sfs client of the fake cloud
+func newFakeClient(t *testing.T, cloud *fake.Cloud) *golangsdk.ServiceClient {
+	client, err := cloud.Credentials().SFSV2Client()
+	if err != nil {
+		t.Fatalf("Failed to create SFS v2 client: %v", err)
+	}
+	return client
+}
+
+func TestFindShareByName(t *testing.T) {
+	tests := []struct {
+		name      string
+		listError int
+		id        string
+		valid     bool
+	}{
+		{name: "pvc-1", id: "share-1", valid: true},
+		{name: "pvc-2", id: "", valid: true},
+		{name: "pvc-1", listError: http.StatusInternalServerError, valid: false},
+		{name: "pvc-1", listError: http.StatusUnauthorized, valid: false},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		cloud.ListError = test.listError
+		// the name filter of some endpoints is a fuzzy match
+		cloud.AddShare(&fake.Share{Share: shares.Share{ID: "share-1", Name: "pvc-1", Status: SFSStatusAvailable}})
+		cloud.AddShare(&fake.Share{Share: shares.Share{ID: "share-10", Name: "pvc-10", Status: SFSStatusAvailable}})
+
+		share, err := FindShareByName(newFakeClient(t, cloud), test.name)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("%s with list error %d: expected valid %v, got %v", test.name, test.listError, test.valid, err)
+		}
+		id := ""
+		if share != nil {
+			id = share.ID
+		}
+		if id != test.id {
+			t.Errorf("%s with list error %d: expected share %q, got %q", test.name, test.listError, test.id, id)
+		}
+		cloud.Close()
+	}
+}
+
+func TestGrantAccessRule(t *testing.T) {
+	access := backends.Access{AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "rw"}
+	tests := []struct {
+		name    string
+		state   string
+		granted bool
+	}{
+		{name: "active rule", state: SFSAccessStateActive, granted: false},
+		{name: "new rule", state: "new", granted: false},
+		{name: "failed rule", state: SFSAccessStateError, granted: true},
+		{name: "denying rule", state: SFSAccessStateDenying, granted: true},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		cloud.DenyPolls = 10
+		cloud.AddShare(&fake.Share{
+			Share: shares.Share{ID: "share-1", Status: SFSStatusAvailable},
+			Access: []shares.AccessRight{
+				{ID: "old", AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "rw", State: test.state},
+			},
+		})
+
+		right, err := GrantAccessRule(newFakeClient(t, cloud), "share-1", access)
+		if err != nil {
+			t.Errorf("%s: GrantAccessRule failed: %v", test.name, err)
+		} else if granted := right.ID != "old"; granted != test.granted {
+			t.Errorf("%s: expected granted %v, got rule %+v", test.name, test.granted, right)
+		}
+		cloud.Close()
+	}
+}
+
+func TestReplaceAccess(t *testing.T) {
+	cloud := fake.NewCloud()
+	defer cloud.Close()
+	cloud.DenyPolls = 3
+	cloud.AddShare(&fake.Share{
+		Share: shares.Share{ID: "share-1", Status: SFSStatusAvailable},
+		Access: []shares.AccessRight{
+			{ID: "old", AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "rw", State: SFSAccessStateError},
+		},
+	})
+	client := newFakeClient(t, cloud)
+	r := &AccessReconciler{provisioner: &Provisioner{sharetimeout: 10, backoff: Backoff{Duration: time.Millisecond, Factor: 1}}}
+
+	var remaining []shares.AccessRight
+	grant := func() error {
+		remaining = cloud.GetShare("share-1").Access
+		_, err := GrantAccessRule(client, "share-1", backends.Access{AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "rw"})
+		return err
+	}
+	if err := r.replaceAccess(client, "share-1", "old", grant)(); err != nil {
+		t.Fatalf("replaceAccess failed: %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("Expected the revoked rule to disappear before granting, got %+v", remaining)
+	}
+	access := cloud.GetShare("share-1").Access
+	if len(access) != 1 || access[0].ID == "old" || access[0].State != SFSAccessStateActive {
+		t.Errorf("Expected a new active rule, got %+v", access)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/golangsdk"
+)
+
+// ShareSnapshot is a point-in-time copy of a share
+type ShareSnapshot struct {
+	ID          string                        `json:"id"`
+	Name        string                        `json:"name"`
+	Description string                        `json:"description"`
+	ShareID     string                        `json:"share_id"`
+	ShareProto  string                        `json:"share_proto"`
+	ShareSize   int                           `json:"share_size"`
+	Size        int                           `json:"size"`
+	Status      string                        `json:"status"`
+	CreatedAt   golangsdk.JSONRFC3339MilliNoZ `json:"created_at"`
+}
+
+// SnapshotListOpts filters the snapshots of ListSnapshots
+type SnapshotListOpts struct {
+	ShareID string `q:"share_id"`
+	Name    string `q:"name"`
+}
+
+// snapshotCreateOpts is the body of a snapshot creation
+type snapshotCreateOpts struct {
+	ShareID     string `json:"share_id" required:"true"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Force       bool   `json:"force"`
+}
+
+// CreateSnapshot of a share in SFS
+func CreateSnapshot(client *golangsdk.ServiceClient, shareID string, name string, description string) (*ShareSnapshot, error) {
+	body, err := golangsdk.BuildRequestBody(snapshotCreateOpts{
+		ShareID:     shareID,
+		Name:        name,
+		Description: description,
+	}, "snapshot")
+	if err != nil {
+		return nil, err
+	}
+
+	glog.Infof("Create snapshot %s of share %s", name, shareID)
+	var result struct {
+		Snapshot *ShareSnapshot `json:"snapshot"`
+	}
+	_, err = client.Post(client.ServiceURL("snapshots"), body, &result, &golangsdk.RequestOpts{
+		OkCodes: []int{200, 202},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create snapshot in SFS: %v", err)
+	}
+	return result.Snapshot, nil
+}
+
+// GetSnapshot in SFS
+func GetSnapshot(client *golangsdk.ServiceClient, snapshotID string) (*ShareSnapshot, error) {
+	var result struct {
+		Snapshot *ShareSnapshot `json:"snapshot"`
+	}
+	_, err := client.Get(client.ServiceURL("snapshots", snapshotID), &result, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.Snapshot, nil
+}
+
+// ListSnapshots in SFS
+func ListSnapshots(client *golangsdk.ServiceClient, opts SnapshotListOpts) ([]ShareSnapshot, error) {
+	query, err := golangsdk.BuildQueryString(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Snapshots []ShareSnapshot `json:"snapshots"`
+	}
+	_, err = client.Get(client.ServiceURL("snapshots", "detail")+query.String(), &result, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.Snapshots, nil
+}
+
+// FindSnapshotByName returns the snapshot with the given name, or nil if there is none
+func FindSnapshotByName(client *golangsdk.ServiceClient, name string) (*ShareSnapshot, error) {
+	snapshots, err := ListSnapshots(client, SnapshotListOpts{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// DeleteSnapshot in SFS
+func DeleteSnapshot(client *golangsdk.ServiceClient, snapshotID string) error {
+	_, err := client.Delete(client.ServiceURL("snapshots", snapshotID), nil)
+	return err
+}
+
+// DeleteSnapshotAndWait deletes the snapshot and waits for it to disappear until ctx is done.
+// A missing snapshot is deleted already.
+func DeleteSnapshotAndWait(ctx context.Context, client *golangsdk.ServiceClient, snapshotID string, backoff Backoff) error {
+	err := DeleteSnapshot(client, snapshotID)
+	if err != nil {
+		if _, ok := err.(golangsdk.ErrDefault404); ok {
+			glog.Infof("Snapshot %s is already deleted", snapshotID)
+			return nil
+		}
+		return err
+	}
+
+	return WaitForSnapshotDeleted(ctx, client, snapshotID, backoff)
+}
+
+// WaitForSnapshotStatus wait for snapshot desired status until ctx is done
+func WaitForSnapshotStatus(ctx context.Context, client *golangsdk.ServiceClient, snapshotID string, desiredStatus string, backoff Backoff) error {
+	return pollSnapshot(ctx, client, snapshotID, backoff, func(snapshot *ShareSnapshot) bool {
+		return snapshot.Status == desiredStatus
+	})
+}
+
+// WaitForSnapshotDeleted wait for snapshot to disappear until ctx is done
+func WaitForSnapshotDeleted(ctx context.Context, client *golangsdk.ServiceClient, snapshotID string, backoff Backoff) error {
+	err := pollSnapshot(ctx, client, snapshotID, backoff, func(snapshot *ShareSnapshot) bool {
+		return false
+	})
+	if _, ok := err.(golangsdk.ErrDefault404); ok {
+		return nil
+	}
+	return err
+}
+
+// pollSnapshot gets the snapshot with backoff until done returns true, the snapshot fails or ctx is done
+func pollSnapshot(ctx context.Context, client *golangsdk.ServiceClient, snapshotID string, backoff Backoff, done func(*ShareSnapshot) bool) error {
+	interval := backoff.Duration
+	lastStatus := "unknown"
+	for {
+		// reduce the amount of API calls
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v, snapshot %s is in status %s", ctx.Err(), snapshotID, lastStatus)
+		case <-timer.C:
+		}
+
+		snapshot, err := GetSnapshot(client, snapshotID)
+		if err != nil {
+			return err
+		}
+		if done(snapshot) {
+			return nil
+		}
+		if snapshot.Status == SFSStatusError || snapshot.Status == SFSStatusErrorDeleting {
+			return fmt.Errorf("snapshot %s is in status %s", snapshotID, snapshot.Status)
+		}
+		lastStatus = snapshot.Status
+		interval = backoff.next(interval)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"github.com/kubernetes-incubator/external-storage/lib/controller"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/apis/core/v1/helper"
+	kubeletapis "k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+const (
+	annSelectedNode       = "volume.kubernetes.io/selected-node"
+	annStorageProvisioner = "volume.beta.kubernetes.io/storage-provisioner"
+)
+
+// ShouldProvision delays the claims of classes waiting for the first consumer until a node is selected
+func (p *Provisioner) ShouldProvision(claim *v1.PersistentVolumeClaim) bool {
+	if claim.Annotations[annStorageProvisioner] != p.name || claim.Annotations[annSelectedNode] != "" {
+		return true
+	}
+
+	class, err := p.getClaimClass(claim)
+	if err != nil {
+		glog.Errorf("Failed to get class of claim %s/%s: %v", claim.Namespace, claim.Name, err)
+		return true
+	}
+	if class.VolumeBindingMode != nil && *class.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer {
+		glog.Infof("Claim %s/%s waits for the first consumer", claim.Namespace, claim.Name)
+		return false
+	}
+	return true
+}
+
+// selectZone returns the availability zone of the share: the zone of the selected node,
+// the availability parameter or the first zone of the allowed topologies of the class.
+func (p *Provisioner) selectZone(volOptions *controller.VolumeOptions) (string, error) {
+	class, err := p.getClaimClass(volOptions.PVC)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get class: %v", err)
+	}
+	allowed := allowedZones(class)
+
+	zone := volOptions.Parameters[SFSParametersAvailability]
+	if nodeName := volOptions.PVC.Annotations[annSelectedNode]; nodeName != "" {
+		node, err := p.clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("Failed to get selected node %s: %v", nodeName, err)
+		}
+		if nodeZone := node.Labels[kubeletapis.LabelZoneFailureDomain]; nodeZone != "" {
+			glog.Infof("Use zone %s of selected node %s", nodeZone, nodeName)
+			zone = nodeZone
+		}
+	}
+
+	if len(allowed) == 0 {
+		return zone, nil
+	}
+	if zone == "" {
+		return allowed[0], nil
+	}
+	for _, z := range allowed {
+		if z == zone {
+			return zone, nil
+		}
+	}
+	return "", fmt.Errorf("Zone %s is not allowed by class %s", zone, class.Name)
+}
+
+// validateShareZone checks that the zone of an existing share is allowed by the class of the claim
+func (p *Provisioner) validateShareZone(claim *v1.PersistentVolumeClaim, share *shares.Share) error {
+	class, err := p.getClaimClass(claim)
+	if err != nil {
+		return fmt.Errorf("Failed to get class: %v", err)
+	}
+	allowed := allowedZones(class)
+	if len(allowed) == 0 {
+		return nil
+	}
+	for _, z := range allowed {
+		if z == share.AvailabilityZone {
+			return nil
+		}
+	}
+	return fmt.Errorf("Zone %q of share %s is not allowed by class %s", share.AvailabilityZone, share.ID, class.Name)
+}
+
+// existingShare checks whether the claim restores or adopts an existing share
+func existingShare(claim *v1.PersistentVolumeClaim) bool {
+	return claim.Annotations[SFSAnnotationRestoreShare] != "" || claim.Annotations[SFSAnnotationAdoptShare] != ""
+}
+
+// setTopology labels the persistent volume with the zone and region of the share
+// and restricts its consumers to the nodes of the zone.
+func setTopology(pv *v1.PersistentVolume, zone, region string) {
+	if zone == "" {
+		return
+	}
+
+	if pv.Labels == nil {
+		pv.Labels = map[string]string{}
+	}
+	pv.Labels[kubeletapis.LabelZoneFailureDomain] = zone
+	if region != "" {
+		pv.Labels[kubeletapis.LabelZoneRegion] = region
+	}
+
+	pv.Spec.NodeAffinity = &v1.VolumeNodeAffinity{
+		Required: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{
+				{
+					MatchExpressions: []v1.NodeSelectorRequirement{
+						{
+							Key:      kubeletapis.LabelZoneFailureDomain,
+							Operator: v1.NodeSelectorOpIn,
+							Values:   []string{zone},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// allowedZones returns the zones of the allowed topologies of the class
+func allowedZones(class *storagev1.StorageClass) []string {
+	var zones []string
+	for _, term := range class.AllowedTopologies {
+		for _, exp := range term.MatchLabelExpressions {
+			if exp.Key == kubeletapis.LabelZoneFailureDomain {
+				zones = append(zones, exp.Values...)
+			}
+		}
+	}
+	return zones
+}
+
+// getClaimClass returns the storage class of the claim
+func (p *Provisioner) getClaimClass(claim *v1.PersistentVolumeClaim) (*storagev1.StorageClass, error) {
+	name := helper.GetPersistentVolumeClaimClass(claim)
+	return p.clientset.StorageV1().StorageClasses().Get(name, metav1.GetOptions{})
+}
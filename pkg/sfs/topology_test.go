@@ -0,0 +1,83 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"testing"
+
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeletapis "k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+func TestValidateShareZone(t *testing.T) {
+	zoned := &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "zoned"},
+		AllowedTopologies: []v1.TopologySelectorTerm{
+			{
+				MatchLabelExpressions: []v1.TopologySelectorLabelRequirement{
+					{Key: kubeletapis.LabelZoneFailureDomain, Values: []string{"az-1", "az-2"}},
+				},
+			},
+		},
+	}
+	unzoned := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "unzoned"}}
+	api := fake.NewAPIServer(zoned, unzoned)
+	defer api.Close()
+	p := &Provisioner{clientset: api.Clientset()}
+
+	tests := []struct {
+		class string
+		zone  string
+		valid bool
+	}{
+		{class: "zoned", zone: "az-2", valid: true},
+		{class: "zoned", zone: "az-3", valid: false},
+		{class: "zoned", zone: "", valid: false},
+		{class: "unzoned", zone: "az-3", valid: true},
+	}
+
+	for _, test := range tests {
+		class := test.class
+		claim := &v1.PersistentVolumeClaim{Spec: v1.PersistentVolumeClaimSpec{StorageClassName: &class}}
+		share := &shares.Share{ID: "share-1", AvailabilityZone: test.zone}
+		err := p.validateShareZone(claim, share)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("Zone %q of class %s: expected valid %v, got %v", test.zone, test.class, test.valid, err)
+		}
+	}
+}
+
+func TestSetTopology(t *testing.T) {
+	pv := &v1.PersistentVolume{}
+	setTopology(pv, "", "region")
+	if pv.Labels != nil || pv.Spec.NodeAffinity != nil {
+		t.Errorf("Expected no topology without zone, got %v %v", pv.Labels, pv.Spec.NodeAffinity)
+	}
+
+	setTopology(pv, "az-1", "region")
+	if pv.Labels[kubeletapis.LabelZoneFailureDomain] != "az-1" || pv.Labels[kubeletapis.LabelZoneRegion] != "region" {
+		t.Errorf("Unexpected labels %v", pv.Labels)
+	}
+	values := pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values
+	if len(values) != 1 || values[0] != "az-1" {
+		t.Errorf("Expected node affinity of zone az-1, got %v", values)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/golangsdk"
+)
+
+// provisionTransaction records the completed steps of a provision,
+// so that they can be compensated if a later step fails.
+type provisionTransaction struct {
+	client    *golangsdk.ServiceClient
+	timeout   int
+	backoff   Backoff
+	shareID   string
+	adopted   bool
+	resumed   bool
+	failed    bool
+	accessIDs []string
+}
+
+// newProvisionTransaction creates an empty transaction
+func newProvisionTransaction(client *golangsdk.ServiceClient, timeout int, backoff Backoff) *provisionTransaction {
+	return &provisionTransaction{
+		client:  client,
+		timeout: timeout,
+		backoff: backoff,
+	}
+}
+
+// shareCreated records the share of the provision
+func (tx *provisionTransaction) shareCreated(shareID string) {
+	tx.shareID = shareID
+}
+
+// shareResumed records the share created by a previous attempt of the provision,
+// which is only deleted on rollback if it failed
+func (tx *provisionTransaction) shareResumed(shareID string) {
+	tx.shareID = shareID
+	tx.resumed = true
+}
+
+// shareFailed records that the share entered a failure status
+func (tx *provisionTransaction) shareFailed() {
+	tx.failed = true
+}
+
+// shareAdopted records an existing share used by the provision, such as a share
+// restored from the recycle bin, which is kept instead of being deleted on rollback
+func (tx *provisionTransaction) shareAdopted(shareID string) {
+	tx.shareID = shareID
+	tx.adopted = true
+}
+
+// accessGranted records an access rule of the provision
+func (tx *provisionTransaction) accessGranted(accessID string) {
+	tx.accessIDs = append(tx.accessIDs, accessID)
+}
+
+// empty checks whether there is nothing to compensate
+func (tx *provisionTransaction) empty() bool {
+	return tx.shareID == ""
+}
+
+// rollback compensates the completed steps in reverse order
+// and returns the descriptions of the compensated steps.
+func (tx *provisionTransaction) rollback() ([]string, error) {
+	var cleaned []string
+
+	// revoke access
+	for len(tx.accessIDs) > 0 {
+		accessID := tx.accessIDs[len(tx.accessIDs)-1]
+		glog.Infof("Rollback: revoke access %s of share %s", accessID, tx.shareID)
+		err := RevokeAccess(tx.client, tx.shareID, accessID)
+		if err != nil {
+			return cleaned, fmt.Errorf("Failed to revoke access %s: %v", accessID, err)
+		}
+		cleaned = append(cleaned, fmt.Sprintf("revoked access %s", accessID))
+		tx.accessIDs = tx.accessIDs[:len(tx.accessIDs)-1]
+	}
+
+	// keep existing share
+	if tx.shareID != "" && tx.adopted {
+		glog.Infof("Rollback: keep existing share %s", tx.shareID)
+		cleaned = append(cleaned, fmt.Sprintf("kept existing share %s", tx.shareID))
+		tx.shareID = ""
+	}
+
+	// keep the share of a previous attempt unless it failed
+	if tx.shareID != "" && tx.resumed && !tx.failed {
+		glog.Infof("Rollback: keep share %s of a previous attempt", tx.shareID)
+		cleaned = append(cleaned, fmt.Sprintf("kept share %s of a previous attempt", tx.shareID))
+		tx.shareID = ""
+	}
+
+	// delete share
+	if tx.shareID != "" {
+		glog.Infof("Rollback: delete share %s", tx.shareID)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(tx.timeout)*time.Second)
+		err := DeleteShareAndWait(ctx, tx.client, tx.shareID, tx.backoff)
+		cancel()
+		if err != nil {
+			return cleaned, fmt.Errorf("Failed to delete share %s: %v", tx.shareID, err)
+		}
+		cleaned = append(cleaned, fmt.Sprintf("deleted share %s", tx.shareID))
+		tx.shareID = ""
+	}
+
+	return cleaned, nil
+}
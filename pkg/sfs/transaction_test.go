@@ -0,0 +1,119 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var testBackoff = Backoff{Duration: time.Millisecond, Factor: 1}
+
+// newTestShare adds an available share with an active access rule to the fake cloud
+func newTestShare(cloud *fake.Cloud, status string) {
+	cloud.AddShare(&fake.Share{
+		Share: shares.Share{ID: "share-1", Status: status},
+		Access: []shares.AccessRight{
+			{ID: "access-1", AccessType: "cert", AccessTo: "vpc-1", AccessLevel: "rw", State: SFSAccessStateActive},
+		},
+	})
+}
+
+func TestProvisionTransactionRollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(tx *provisionTransaction)
+		kept   bool
+	}{
+		{
+			name:   "created share",
+			record: func(tx *provisionTransaction) { tx.shareCreated("share-1") },
+			kept:   false,
+		},
+		{
+			name:   "resumed share",
+			record: func(tx *provisionTransaction) { tx.shareResumed("share-1") },
+			kept:   true,
+		},
+		{
+			name: "failed resumed share",
+			record: func(tx *provisionTransaction) {
+				tx.shareResumed("share-1")
+				tx.shareFailed()
+			},
+			kept: false,
+		},
+		{
+			name:   "adopted share",
+			record: func(tx *provisionTransaction) { tx.shareAdopted("share-1") },
+			kept:   true,
+		},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		newTestShare(cloud, SFSStatusAvailable)
+		tx := newProvisionTransaction(newFakeClient(t, cloud), 10, testBackoff)
+		test.record(tx)
+		tx.accessGranted("access-1")
+
+		if _, err := tx.rollback(); err != nil {
+			t.Errorf("%s: rollback failed: %v", test.name, err)
+		}
+		share := cloud.GetShare("share-1")
+		if kept := share != nil; kept != test.kept {
+			t.Errorf("%s: expected kept %v, got %v", test.name, test.kept, kept)
+		}
+		if share != nil && share.Access[0].State != SFSAccessStateDenying {
+			t.Errorf("%s: expected the granted access to be revoked, got %+v", test.name, share.Access)
+		}
+		cloud.Close()
+	}
+}
+
+func TestProvisionerRollbackTimeout(t *testing.T) {
+	cloud := fake.NewCloud()
+	defer cloud.Close()
+	newTestShare(cloud, "creating")
+	recorder := record.NewFakeRecorder(10)
+	p := &Provisioner{recorder: recorder}
+
+	tx := newProvisionTransaction(newFakeClient(t, cloud), 10, testBackoff)
+	tx.shareCreated("share-1")
+	tx.accessGranted("access-1")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+
+	p.rollback(ctx, tx, &v1.PersistentVolumeClaim{})
+	share := cloud.GetShare("share-1")
+	if share == nil || share.Access[0].State != SFSAccessStateActive {
+		t.Errorf("Expected the share of a timed out provision to be kept, got %+v", share)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Logf("Event: %s", event)
+	default:
+		t.Errorf("Expected an event of the skipped rollback")
+	}
+}
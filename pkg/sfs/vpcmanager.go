@@ -17,8 +17,13 @@ limitations under the License.
 package sfs
 
 import (
-	"io/ioutil"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/huaweicloud/external-sfs/pkg/config"
@@ -28,85 +33,312 @@ import (
 	"github.com/gophercloud/gophercloud/pagination"
 
 	"github.com/huaweicloud/golangsdk/openstack/networking/v1/subnets"
+
+	"k8s.io/api/core/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
-// InitVPC for share
-func InitVPC(cc config.CloudCredentials) string {
-	// define vpcid
-	vpcid := ""
+const (
+	// metadataURL is the url of the ECS metadata of the local instance
+	metadataURL = "http://169.254.169.254/openstack/latest/meta_data.json"
+
+	// nodeResyncPeriod is the resync period of the node informer, unresolved nodes are retried on resync
+	nodeResyncPeriod = 10 * time.Minute
+)
+
+// VPCCache holds the vpcs of the cluster, which are the configured vpc or
+// the vpcs of the subnets of the instances of the nodes.
+type VPCCache struct {
+	cloudconfig *config.Store
+	static      string
+
+	mu      sync.RWMutex
+	nodes   map[string][]string
+	subnets map[string]string
+	local   []string
+	synced  chan struct{}
+}
+
+// NewVPCCache creates a cache of the vpcs of the cluster, nodes are not watched if vpcid is set
+func NewVPCCache(cc *config.Store, vpcid string) *VPCCache {
+	return &VPCCache{
+		cloudconfig: cc,
+		static:      vpcid,
+		nodes:       map[string][]string{},
+		subnets:     map[string]string{},
+		synced:      make(chan struct{}),
+	}
+}
+
+// IDs returns the sorted vpc ids of the cluster, the vpcs of the local instance are
+// used if no node could be resolved.
+func (c *VPCCache) IDs() []string {
+	if c.static != "" {
+		return []string{c.static}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	set := map[string]bool{}
+	for _, vpcs := range c.nodes {
+		for _, vpc := range vpcs {
+			set[vpc] = true
+		}
+	}
+	if len(set) == 0 {
+		return c.local
+	}
 
-	// get instanceid
-	glog.Info("get instance id...")
-	instanceID := readInstanceID()
+	ids := make([]string, 0, len(set))
+	for vpc := range set {
+		ids = append(ids, vpc)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WaitForSync waits until the vpcs of the existing nodes are resolved,
+// returns false if the stop channel is closed before
+func (c *VPCCache) WaitForSync(stopCh <-chan struct{}) bool {
+	select {
+	case <-c.synced:
+		return true
+	case <-stopCh:
+		return false
+	}
+}
+
+// Run resolves the vpcs of the nodes when they are added or their provider id changes
+// until the stop channel is closed
+func (c *VPCCache) Run(client clientset.Interface, stopCh <-chan struct{}) {
+	if c.static != "" {
+		glog.Infof("Use configured vpc %s", c.static)
+		close(c.synced)
+		return
+	}
+
+	local, err := DiscoverLocalVPCs(*c.cloudconfig.Get())
+	if err != nil {
+		glog.Warningf("Failed to discover vpcs of the local instance: %v", err)
+	}
+	c.mu.Lock()
+	c.local = local
+	c.mu.Unlock()
+
+	source := cache.NewListWatchFromClient(client.CoreV1().RESTClient(), "nodes", v1.NamespaceAll, nil)
+	_, controller := cache.NewInformer(source, &v1.Node{}, nodeResyncPeriod, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok {
+				c.resolveNode(node)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok := oldObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			node, ok := newObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			// retry unresolved nodes on resync only, status updates are too frequent
+			resync := oldNode.ResourceVersion == node.ResourceVersion
+			if oldNode.Spec.ProviderID != node.Spec.ProviderID || (resync && !c.resolved(node.Name)) {
+				c.resolveNode(node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*v1.Node); ok {
+				c.mu.Lock()
+				delete(c.nodes, node.Name)
+				c.mu.Unlock()
+			}
+		},
+	})
+	go controller.Run(stopCh)
+
+	// the nodes of the initial list are resolved once the informer synced
+	if !cache.WaitForCacheSync(stopCh, controller.HasSynced) {
+		return
+	}
+	glog.Infof("Resolved vpcs of the nodes: %v", c.IDs())
+	close(c.synced)
+	<-stopCh
+}
+
+// resolved checks whether the vpcs of the node are known
+func (c *VPCCache) resolved(nodeName string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.nodes[nodeName]) > 0
+}
+
+// resolveNode resolves the vpcs of the instance of the node
+func (c *VPCCache) resolveNode(node *v1.Node) {
+	instanceID := instanceIDFromProviderID(node.Spec.ProviderID)
 	if instanceID == "" {
-		glog.Info("Failed to get instance id")
-		return vpcid
+		glog.Warningf("Node %s has no provider id %q of an instance", node.Name, node.Spec.ProviderID)
+		return
 	}
 
-	// init compute client
-	glog.Info("Init compute client...")
+	vpcs, err := c.instanceVPCs(instanceID)
+	if err != nil {
+		glog.Errorf("Failed to resolve vpcs of node %s: %v", node.Name, err)
+		return
+	}
+	glog.Infof("Get vpcs of node %s: %v", node.Name, vpcs)
+
+	c.mu.Lock()
+	c.nodes[node.Name] = vpcs
+	c.mu.Unlock()
+}
+
+// instanceVPCs returns the vpcs of the subnets of the instance, the vpcs of the subnets are cached
+func (c *VPCCache) instanceVPCs(instanceID string) ([]string, error) {
+	cc := c.cloudconfig.Get()
 	computeClient, err := cc.ComputeV2Client()
 	if err != nil {
-		glog.Infof("Failed to create compute v2 client: %v", err)
-		return vpcid
+		return nil, fmt.Errorf("Failed to create compute v2 client: %v", err)
+	}
+	networkClient, err := cc.NetworkingV1Client()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create network v1 client: %v", err)
+	}
+
+	return resolveInstanceVPCs(computeClient, instanceID, func(subnetID string) (string, error) {
+		c.mu.RLock()
+		vpc, ok := c.subnets[subnetID]
+		c.mu.RUnlock()
+		if ok {
+			return vpc, nil
+		}
+
+		subnet, err := subnets.Get(networkClient, subnetID).Extract()
+		if err != nil {
+			return "", err
+		}
+		c.mu.Lock()
+		c.subnets[subnetID] = subnet.VPC_ID
+		c.mu.Unlock()
+		return subnet.VPC_ID, nil
+	})
+}
+
+// DiscoverLocalVPCs returns the vpcs of the instance running the process, the instance is read from the ECS metadata
+func DiscoverLocalVPCs(cc config.CloudCredentials) ([]string, error) {
+	metadata, err := readInstanceMetadata()
+	if err != nil {
+		return nil, err
 	}
+	instanceID := metadata.UUID
 
-	// init sfs client
-	glog.Info("Init network client...")
+	computeClient, err := cc.ComputeV2Client()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create compute v2 client: %v", err)
+	}
 	networkClient, err := cc.NetworkingV1Client()
 	if err != nil {
-		glog.Infof("Failed to create network v2 client: %v", err)
-		return vpcid
+		return nil, fmt.Errorf("Failed to create network v1 client: %v", err)
 	}
 
-	// get interfaces
+	return resolveInstanceVPCs(computeClient, instanceID, func(subnetID string) (string, error) {
+		subnet, err := subnets.Get(networkClient, subnetID).Extract()
+		if err != nil {
+			return "", err
+		}
+		return subnet.VPC_ID, nil
+	})
+}
+
+// resolveInstanceVPCs returns the sorted vpcs of the subnets of the interfaces of the instance
+func resolveInstanceVPCs(computeClient *gophercloud.ServiceClient, instanceID string, subnetVPC func(string) (string, error)) ([]string, error) {
 	interfaces, err := getAttachedInterfacesByID(computeClient, instanceID)
 	if err != nil {
-		glog.Infof("Failed to get interfaces: %v", err)
-		return vpcid
+		return nil, fmt.Errorf("Failed to get interfaces of instance %s: %v", instanceID, err)
 	}
 
-	// get subnet id
-	subnetid := ""
+	set := map[string]bool{}
 	for _, intf := range interfaces {
-		if intf.NetID != "" {
-			subnetid = intf.NetID
-			break
+		if intf.NetID == "" {
+			continue
+		}
+		vpc, err := subnetVPC(intf.NetID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get subnet %s: %v", intf.NetID, err)
+		}
+		if vpc != "" {
+			set[vpc] = true
 		}
 	}
-	if subnetid == "" {
-		glog.Info("Failed to get subnet id")
-		return vpcid
+	if len(set) == 0 {
+		return nil, fmt.Errorf("Instance %s has no interface in a vpc", instanceID)
 	}
-	glog.Infof("Get subnet id: %s", subnetid)
 
-	// get routers
-	subnet, err := subnets.Get(networkClient, subnetid).Extract()
-	if err != nil {
-		glog.Infof("Failed to get subnet: %v", err)
-		return vpcid
+	vpcs := make([]string, 0, len(set))
+	for vpc := range set {
+		vpcs = append(vpcs, vpc)
 	}
+	sort.Strings(vpcs)
+	return vpcs, nil
+}
 
-	// get vpc id
-	vpcid = subnet.VPC_ID
-	glog.Infof("Get vpc id: %s", vpcid)
+// instanceIDFromProviderID returns the instance id of a provider id such as
+// openstack:///<instance id> or huaweicloud://<instance id>
+func instanceIDFromProviderID(providerID string) string {
+	pos := strings.Index(providerID, "://")
+	if pos < 0 {
+		return ""
+	}
+	id := strings.Trim(providerID[pos+3:], "/")
+	if strings.Contains(id, "/") {
+		id = id[strings.LastIndex(id, "/")+1:]
+	}
+	return id
+}
 
-	return vpcid
+// DiscoverLocalZone returns the availability zone of the instance running the process from the ECS metadata
+func DiscoverLocalZone() (string, error) {
+	metadata, err := readInstanceMetadata()
+	if err != nil {
+		return "", err
+	}
+	if metadata.AvailabilityZone == "" {
+		return "", fmt.Errorf("Instance metadata has no availability_zone")
+	}
+	return metadata.AvailabilityZone, nil
 }
 
-// readInstanceID from local file
-func readInstanceID() string {
-	const instanceIDFile = "/var/lib/cloud/data/instance-id"
-	idBytes, err := ioutil.ReadFile(instanceIDFile)
+// instanceMetadata is the ECS metadata of the local instance
+type instanceMetadata struct {
+	UUID             string `json:"uuid"`
+	AvailabilityZone string `json:"availability_zone"`
+}
+
+// readInstanceMetadata of the local instance from the ECS metadata
+func readInstanceMetadata() (*instanceMetadata, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(metadataURL)
 	if err != nil {
-		glog.Infof("Failed to get instance id from file: %v", err)
-		return ""
-	} else {
-		instanceID := string(idBytes)
-		instanceID = strings.TrimSpace(instanceID)
-		glog.Infof("Get instance id from file: %s", instanceID)
-		return instanceID
+		return nil, fmt.Errorf("Failed to get instance metadata: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to get instance metadata: %s", resp.Status)
+	}
+
+	var metadata instanceMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("Failed to decode instance metadata: %v", err)
+	}
+	if metadata.UUID == "" {
+		return nil, fmt.Errorf("Instance metadata has no uuid")
 	}
+	glog.Infof("Get instance id from metadata: %s zone: %s", metadata.UUID, metadata.AvailabilityZone)
+	return &metadata, nil
 }
 
 // getAttachedInterfacesByID returns the node interfaces of the specified instance.
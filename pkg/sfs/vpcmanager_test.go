@@ -0,0 +1,41 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"testing"
+)
+
+func TestVPCCacheWaitForSync(t *testing.T) {
+	stopCh := make(chan struct{})
+	close(stopCh)
+
+	// the nodes are not resolved before the cache runs
+	c := NewVPCCache(nil, "vpc-1")
+	if c.WaitForSync(stopCh) {
+		t.Errorf("Expected the cache not to be synced before it runs")
+	}
+
+	// a configured vpc is synced immediately
+	c.Run(nil, stopCh)
+	if !c.WaitForSync(make(chan struct{})) {
+		t.Errorf("Expected the cache of a configured vpc to be synced")
+	}
+	if ids := c.IDs(); len(ids) != 1 || ids[0] != "vpc-1" {
+		t.Errorf("Expected vpc-1, got %v", ids)
+	}
+}
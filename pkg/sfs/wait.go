@@ -0,0 +1,246 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+)
+
+// share status from which sfs does not recover by itself
+var shareFailedStatus = map[string]bool{
+	SFSStatusError:          true,
+	SFSStatusErrorDeleting:  true,
+	SFSStatusExtendingError: true,
+	SFSStatusShrinkingError: true,
+}
+
+// Backoff defines the intervals between two polls of a share
+type Backoff struct {
+	// Duration is the interval before the first poll
+	Duration time.Duration
+	// Factor multiplies the interval after each poll
+	Factor float64
+	// Cap limits the interval, no limit if it is zero
+	Cap time.Duration
+}
+
+// DefaultBackoff starts polling after 2 seconds and backs off up to 30 seconds
+var DefaultBackoff = Backoff{
+	Duration: 2 * time.Second,
+	Factor:   1.5,
+	Cap:      30 * time.Second,
+}
+
+// next returns the interval following the given one
+func (b Backoff) next(interval time.Duration) time.Duration {
+	if b.Factor > 1 {
+		interval = time.Duration(float64(interval) * b.Factor)
+	}
+	if b.Cap > 0 && interval > b.Cap {
+		interval = b.Cap
+	}
+	return interval
+}
+
+// ShareFailedError is returned when a share enters a failure status while waiting
+type ShareFailedError struct {
+	ShareID string
+	Status  string
+	Detail  string
+}
+
+func (e *ShareFailedError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("share %s is in status %s", e.ShareID, e.Status)
+	}
+	return fmt.Sprintf("share %s is in status %s: %s", e.ShareID, e.Status, e.Detail)
+}
+
+// IsShareFailed checks whether err reports a share in a failure status
+func IsShareFailed(err error) bool {
+	_, ok := err.(*ShareFailedError)
+	return ok
+}
+
+// WaitForShareStatus wait for share desired status until ctx is done
+func WaitForShareStatus(ctx context.Context, client *golangsdk.ServiceClient, shareID string, desiredStatus string, backoff Backoff) error {
+	return pollShare(ctx, client, shareID, backoff, func(share *shares.Share) bool {
+		return share.Status == desiredStatus
+	})
+}
+
+// WaitForShareDeleted wait for share to disappear until ctx is done
+func WaitForShareDeleted(ctx context.Context, client *golangsdk.ServiceClient, shareID string, backoff Backoff) error {
+	err := pollShare(ctx, client, shareID, backoff, func(share *shares.Share) bool {
+		return false
+	})
+	if _, ok := err.(golangsdk.ErrDefault404); ok {
+		return nil
+	}
+	return err
+}
+
+// DeleteShareAndWait deletes the share and waits for it to disappear until ctx is done.
+// A missing share is deleted already, a delete ending in error_deleting is retried with the
+// force delete action. The ShareFailedError is returned if the force delete is refused or fails too.
+func DeleteShareAndWait(ctx context.Context, client *golangsdk.ServiceClient, shareID string, backoff Backoff) error {
+	err := DeleteShare(client, shareID)
+	if err != nil {
+		if _, ok := err.(golangsdk.ErrDefault404); ok {
+			glog.Infof("Share %s is already deleted", shareID)
+			return nil
+		}
+		return err
+	}
+
+	err = WaitForShareDeleted(ctx, client, shareID, backoff)
+	if err == nil || !IsShareFailed(err) {
+		return err
+	}
+
+	glog.Warningf("Deleting share %s failed: %v, force delete", shareID, err)
+	if forceErr := ForceDeleteShare(client, shareID); forceErr != nil {
+		if _, ok := forceErr.(golangsdk.ErrDefault404); ok {
+			return nil
+		}
+		glog.Errorf("Failed to force delete share %s: %v", shareID, forceErr)
+		return err
+	}
+	return WaitForShareDeleted(ctx, client, shareID, backoff)
+}
+
+// WaitForAccessActive wait for the access rules of the share to become active until ctx is done
+func WaitForAccessActive(ctx context.Context, client *golangsdk.ServiceClient, shareID string, accessIDs []string, backoff Backoff) error {
+	interval := backoff.Duration
+	pending := accessIDs
+	for len(pending) > 0 {
+		// reduce the amount of API calls
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v, access rules %v of share %s are not active", ctx.Err(), pending, shareID)
+		case <-timer.C:
+		}
+
+		rights, err := shares.ListAccessRights(client, shareID).ExtractAccessRights()
+		if err != nil {
+			return err
+		}
+		states := map[string]string{}
+		for _, r := range rights {
+			states[r.ID] = r.State
+		}
+
+		pending = nil
+		for _, id := range accessIDs {
+			switch states[id] {
+			case SFSAccessStateActive:
+			case SFSAccessStateError:
+				return fmt.Errorf("access rule %s of share %s is in state %s", id, shareID, SFSAccessStateError)
+			default:
+				pending = append(pending, id)
+			}
+		}
+		interval = backoff.next(interval)
+	}
+	return nil
+}
+
+// WaitForAccessRevoked wait for the access rule to disappear from the share until ctx is done
+func WaitForAccessRevoked(ctx context.Context, client *golangsdk.ServiceClient, shareID string, accessID string, backoff Backoff) error {
+	interval := backoff.Duration
+	for {
+		// reduce the amount of API calls
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v, access rule %s of share %s is not revoked", ctx.Err(), accessID, shareID)
+		case <-timer.C:
+		}
+
+		rights, err := shares.ListAccessRights(client, shareID).ExtractAccessRights()
+		if err != nil {
+			return err
+		}
+		revoked := true
+		for _, r := range rights {
+			if r.ID == accessID {
+				revoked = false
+				break
+			}
+		}
+		if revoked {
+			return nil
+		}
+		interval = backoff.next(interval)
+	}
+}
+
+// pollShare gets the share with backoff until done returns true, the share fails or ctx is done
+func pollShare(ctx context.Context, client *golangsdk.ServiceClient, shareID string, backoff Backoff, done func(*shares.Share) bool) error {
+	interval := backoff.Duration
+	lastStatus := "unknown"
+	for {
+		// reduce the amount of API calls
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v, share %s is in status %s", ctx.Err(), shareID, lastStatus)
+		case <-timer.C:
+		}
+
+		share, detail, err := getShareWithDetail(client, shareID)
+		if err != nil {
+			return err
+		}
+		if done(share) {
+			return nil
+		}
+		if shareFailedStatus[share.Status] {
+			return &ShareFailedError{ShareID: shareID, Status: share.Status, Detail: detail}
+		}
+		lastStatus = share.Status
+		interval = backoff.next(interval)
+	}
+}
+
+// getShareWithDetail gets the share together with its status detail,
+// which is not part of shares.Share and may be missing.
+func getShareWithDetail(client *golangsdk.ServiceClient, shareID string) (*shares.Share, string, error) {
+	result := shares.Get(client, shareID)
+	share, err := result.Extract()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var detail string
+	if body, ok := result.Body.(map[string]interface{}); ok {
+		if s, ok := body["share"].(map[string]interface{}); ok {
+			detail, _ = s["status_detail"].(string)
+		}
+	}
+	return share, detail, nil
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sfs
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/huaweicloud/external-sfs/pkg/sfs/fake"
+	"github.com/huaweicloud/golangsdk/openstack/sfs/v2/shares"
+)
+
+func TestDeleteShareAndWait(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(*fake.Cloud)
+		exists bool
+		failed bool
+		forced int
+	}{
+		{
+			name:  "deleted",
+			setup: func(c *fake.Cloud) {},
+		},
+		{
+			name:   "force deleted after error_deleting",
+			setup:  func(c *fake.Cloud) { c.DeleteStatus = SFSStatusErrorDeleting },
+			forced: 1,
+		},
+		{
+			name: "force delete refused",
+			setup: func(c *fake.Cloud) {
+				c.DeleteStatus = SFSStatusErrorDeleting
+				c.ForceDeleteError = http.StatusForbidden
+			},
+			exists: true,
+			failed: true,
+			forced: 1,
+		},
+		{
+			name: "force delete failed",
+			setup: func(c *fake.Cloud) {
+				c.DeleteStatus = SFSStatusErrorDeleting
+				c.ForceDeleteStatus = SFSStatusErrorDeleting
+			},
+			exists: true,
+			failed: true,
+			forced: 1,
+		},
+	}
+
+	for _, test := range tests {
+		cloud := fake.NewCloud()
+		test.setup(cloud)
+		cloud.AddShare(&fake.Share{
+			Share:        shares.Share{ID: "share-1", Status: SFSStatusAvailable},
+			StatusDetail: "backend unreachable",
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := DeleteShareAndWait(ctx, newFakeClient(t, cloud), "share-1", testBackoff)
+		cancel()
+		if failed := IsShareFailed(err); failed != test.failed || (!test.failed && err != nil) {
+			t.Errorf("%s: expected failed %v, got %v", test.name, test.failed, err)
+		}
+		if failed, ok := err.(*ShareFailedError); ok && failed.Detail != "backend unreachable" {
+			t.Errorf("%s: expected the status detail, got %q", test.name, failed.Detail)
+		}
+		if exists := cloud.GetShare("share-1") != nil; exists != test.exists {
+			t.Errorf("%s: expected exists %v, got %v", test.name, test.exists, exists)
+		}
+		if calls := cloud.Calls("delete"); calls != 1 {
+			t.Errorf("%s: expected one delete, got %d", test.name, calls)
+		}
+		if calls := cloud.Calls("os-force_delete"); calls != test.forced {
+			t.Errorf("%s: expected %d force deletes, got %d", test.name, test.forced, calls)
+		}
+		cloud.Close()
+	}
+
+	// a missing share is deleted already
+	cloud := fake.NewCloud()
+	defer cloud.Close()
+	if err := DeleteShareAndWait(context.Background(), newFakeClient(t, cloud), "missing", testBackoff); err != nil {
+		t.Errorf("Expected a missing share to be deleted, got %v", err)
+	}
+}